@@ -0,0 +1,57 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/hooks"
+)
+
+func newDaemonCommand() *cobra.Command {
+	var configPath string
+	cmd := &cobra.Command{
+		Use:   "daemon --config hooks.yaml",
+		Short: "Run hooks when IMDS events occur",
+		Long: `Poll IMDS and run hooks when events occur. Each hook maps events to actions: a command that
+receives the event as JSON on stdin, or a webhook the event is POSTed to. Each event fires once,
+and fired events are recorded in the state file so they do not fire again after a restart.
+
+Events: spot-interruption, rebalance-recommendation, maintenance-scheduled, tags-changed,
+lifecycle-state-changed.`,
+		Example: `  imds daemon --config /etc/imds/hooks.yaml`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := hooks.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			client, err := newClient(cmd.Context(), opts.Endpoint)
+			if err != nil {
+				return fmt.Errorf("creating client: %w", err)
+			}
+			d, err := hooks.New(client, cfg)
+			if err != nil {
+				return err
+			}
+			return d.Run(cmd.Context())
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", "", "Hooks config file")
+	_ = cmd.MarkFlagRequired("config")
+	return cmd
+}
@@ -0,0 +1,175 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/diff"
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/snapshot"
+)
+
+const liveSource = "live"
+
+type DiffOptions struct {
+	Ignore         []string
+	IgnoreVolatile bool
+	JSONPatch      bool
+}
+
+var (
+	diffHeaderStyle = lipgloss.NewStyle().Bold(true)
+	diffPathStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	diffAddStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	diffRemoveStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+func newDiffCommand() *cobra.Command {
+	diffOpts := &DiffOptions{}
+	cmd := &cobra.Command{
+		Use:   "diff <a> [b]",
+		Short: "Compare metadata between snapshots and live IMDS",
+		Long: `Show the paths added, removed or changed between two metadata sources. Each source is a
+snapshot or JSON tree file, "live" for IMDS at --endpoint, or an IMDS endpoint URL. b defaults
+to live.
+
+Keys expected to differ between instances, such as instance-id, addresses and credentials, are
+ignored unless --ignore-volatile=false is set. Exits 7 if the sources differ, 1 if a source
+cannot be read, 4 or 5 if IMDS is unreachable or refuses the request, and 6 if some live paths
+could not be read, rather than reporting them as differences.`,
+		Example: `  imds diff known-good.json                 # known-good snapshot vs. this instance
+  imds diff before.json after.json
+  imds diff known-good.json --ignore 'meta-data/tags/**'
+  imds diff known-good.json live --json-patch`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				args = append(args, liveSource)
+			}
+			ignore := diffOpts.Ignore
+			if diffOpts.IgnoreVolatile {
+				ignore = append(append([]string{}, diff.DefaultVolatile...), ignore...)
+			}
+
+			var trees [2]map[string]any
+			var labels [2]string
+			for i, source := range args {
+				backend, label, err := openSource(cmd, source)
+				if err != nil {
+					return err
+				}
+				// A tree missing paths that could not be read would be reported as
+				// differences, so fail with the partial or unreachable code instead.
+				tree, err := getAll(cmd.Context(), backend, "")
+				if err != nil {
+					return fmt.Errorf("reading %s: %w", label, err)
+				}
+				trees[i], labels[i] = tree, label
+			}
+
+			changes := diff.Compare(trees[0], trees[1], diff.Options{Ignore: ignore})
+			if diffOpts.JSONPatch {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(diff.JSONPatch(changes)); err != nil {
+					return err
+				}
+			} else {
+				printChanges(labels, changes)
+			}
+			if len(changes) > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &exitCodeError{code: exitDiffers}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&diffOpts.Ignore, "ignore", nil, "Glob of paths to ignore (repeatable)")
+	cmd.Flags().BoolVar(&diffOpts.IgnoreVolatile, "ignore-volatile", true, "Ignore keys expected to differ, such as instance-id, addresses and credentials")
+	cmd.Flags().BoolVar(&diffOpts.JSONPatch, "json-patch", false, "Output the differences as a JSON Patch (RFC 6902)")
+	return cmd
+}
+
+// openSource opens a diff source and returns it with a label for the header.
+func openSource(cmd *cobra.Command, source string) (imds.Backend, string, error) {
+	endpoint := ""
+	switch {
+	case source == liveSource:
+		endpoint = opts.Endpoint
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		endpoint = source
+	}
+	if endpoint != "" {
+		client, err := newClient(cmd.Context(), endpoint)
+		if err != nil {
+			return nil, "", fmt.Errorf("creating client: %w", err)
+		}
+		if err := probe(cmd.Context(), client); err != nil {
+			return nil, "", err
+		}
+		return client, "live " + client.Endpoint(), nil
+	}
+
+	backend, err := loadBackend(source)
+	if err != nil {
+		return nil, "", err
+	}
+	if snap, ok := backend.(*snapshot.Snapshot); ok {
+		return backend, fmt.Sprintf("%s (captured %s)", source, snap.CapturedAt.Format("2006-01-02T15:04:05Z07:00")), nil
+	}
+	return backend, source, nil
+}
+
+func printChanges(labels [2]string, changes []diff.Change) {
+	fmt.Println(diffHeaderStyle.Render("--- " + labels[0]))
+	fmt.Println(diffHeaderStyle.Render("+++ " + labels[1]))
+	for _, c := range changes {
+		fmt.Println(diffPathStyle.Render("@@ " + c.Path + " @@"))
+		if c.Op != diff.OpAdd {
+			printDiffValue(diffRemoveStyle, "-", c.From)
+		}
+		if c.Op != diff.OpRemove {
+			printDiffValue(diffAddStyle, "+", c.To)
+		}
+	}
+}
+
+func printDiffValue(style lipgloss.Style, prefix string, v any) {
+	var text string
+	switch v := v.(type) {
+	case string:
+		text = v
+	case []any:
+		lines := make([]string, 0, len(v))
+		for _, item := range v {
+			lines = append(lines, fmt.Sprint(item))
+		}
+		text = strings.Join(lines, "\n")
+	default:
+		data, _ := imds.MarshalIndent(v, "", "  ")
+		text = string(data)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Println(style.Render(prefix + line))
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/doctor"
+)
+
+type DoctorOptions struct {
+	JSON bool
+}
+
+var doctorStatusStyles = map[doctor.Status]struct {
+	symbol string
+	style  lipgloss.Style
+}{
+	doctor.StatusPass: {"✓", lipgloss.NewStyle().Foreground(lipgloss.Color("2"))},
+	doctor.StatusWarn: {"!", lipgloss.NewStyle().Foreground(lipgloss.Color("3"))},
+	doctor.StatusFail: {"✗", lipgloss.NewStyle().Foreground(lipgloss.Color("1"))},
+	doctor.StatusSkip: {"-", lipgloss.NewStyle().Faint(true)},
+}
+
+var doctorHintStyle = lipgloss.NewStyle().Faint(true)
+
+func newDoctorCommand() *cobra.Command {
+	doctorOpts := &DoctorOptions{}
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose IMDS connectivity and configuration",
+		Long: `Run checks that explain why IMDS cannot be reached or used: proxy settings, the IMDSv2 token PUT,
+reads with and without a session token, the IPv4 and IPv6 endpoints, latency, and whether instance tags and
+IAM credentials are available. Failures and warnings come with a hint on how to fix them.
+
+Exits 1 if any check fails.`,
+		Example: `  imds doctor
+  imds doctor --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient(cmd.Context(), opts.Endpoint)
+			if err != nil {
+				return fmt.Errorf("creating client: %w", err)
+			}
+			report := doctor.Run(cmd.Context(), doctor.Options{Endpoint: client.Endpoint(), Timeout: opts.Timeout})
+			if doctorOpts.JSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printDoctorReport(report)
+			}
+			if !report.OK() {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &exitCodeError{code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&doctorOpts.JSON, "json", "j", false, "Output the report as JSON")
+	return cmd
+}
+
+func printDoctorReport(report *doctor.Report) {
+	fmt.Printf("IMDS at %s\n\n", report.Endpoint)
+	width := 0
+	for _, c := range report.Checks {
+		width = max(width, len(c.Name))
+	}
+	for _, c := range report.Checks {
+		s := doctorStatusStyles[c.Status]
+		fmt.Printf("%s %-*s  %s\n", s.style.Render(s.symbol), width, c.Name, c.Detail)
+		if c.Hint != "" {
+			fmt.Printf("  %-*s  %s\n", width, "", doctorHintStyle.Render("hint: "+c.Hint))
+		}
+	}
+}
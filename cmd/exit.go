@@ -0,0 +1,63 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Exit codes, documented in the README. imds run exits with its command's
+// exit code instead.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitNotFound     = 2
+	exitAmbiguous    = 3
+	exitUnreachable  = 4
+	exitUnauthorized = 5
+	exitPartial      = 6
+	exitDiffers      = 7
+)
+
+var (
+	// errAmbiguous means a key name matches more than one path.
+	errAmbiguous = errors.New("ambiguous key")
+	// errPartial means some of the requested tree could not be read.
+	errPartial = errors.New("partial data")
+)
+
+// exitCode returns the exit code for an error returned by a command.
+func exitCode(err error) int {
+	var exitErr *exitCodeError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, errPartial):
+		return exitPartial
+	case errors.Is(err, errAmbiguous):
+		return exitAmbiguous
+	case errors.Is(err, imds.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, imds.ErrTokenUnavailable), errors.Is(err, imds.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, imds.ErrUnreachable):
+		return exitUnreachable
+	}
+	return exitError
+}
@@ -0,0 +1,136 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bwagner5/imds/pkg/format"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// keyAliases are short names accepted in place of key names.
+var keyAliases = map[string]string{
+	"az":    "availability-zone",
+	"az-id": "availability-zone-id",
+}
+
+// keyValue is the result of looking up one key.
+type keyValue struct {
+	key   string
+	value []byte
+	err   error
+}
+
+// queryKeys looks up keys concurrently and writes them with formatter, as a
+// tree of key names to values. Keys that fail are reported on stderr and the
+// others still written.
+func queryKeys(ctx context.Context, client imds.Backend, keys []string, formatter format.Formatter) error {
+	// Smart lookups share one crawl rather than each crawling IMDS.
+	var index imds.Backend = client
+	for _, key := range keys {
+		if !strings.Contains(key, "/") {
+			index = imds.NewMemory(client.GetAll(ctx, ""))
+			break
+		}
+	}
+
+	results := make([]keyValue, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, _, err := lookup(ctx, client, index, key)
+			results[i] = keyValue{key: key, value: value, err: err}
+		}()
+	}
+	wg.Wait()
+
+	found := map[string]any{}
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		found[r.key] = jsonValue(r.value)
+	}
+	if len(found) == 0 && len(errs) == 1 {
+		return errs[0]
+	}
+	if len(found) > 0 {
+		if err := formatter.Format(os.Stdout, found); err != nil {
+			return err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	// Report each failure on its own line; the exit code reflects them all.
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	return &exitCodeError{code: exitCode(errors.Join(errs...))}
+}
+
+// lookup resolves key as a query does: by name anywhere in index for keys
+// without a slash, otherwise or failing that by path. The matching paths are
+// returned with an error wrapping errAmbiguous if the name is ambiguous.
+func lookup(ctx context.Context, client, index imds.Backend, key string) ([]byte, []string, error) {
+	if !strings.Contains(key, "/") {
+		name := key
+		if alias, ok := keyAliases[key]; ok {
+			name = alias
+		}
+		found := imds.FindKeys(ctx, index, name)
+		if len(found) > 1 {
+			return nil, found, fmt.Errorf("%w %q: use the full path", errAmbiguous, key)
+		}
+		if len(found) == 1 {
+			resp, err := client.Get(ctx, found[0])
+			if err == nil && !imds.IsDirectory(resp) {
+				return resp, nil, nil
+			}
+		}
+	}
+
+	resp, err := client.Get(ctx, imds.NormalizePath(key))
+	if errors.Is(err, imds.ErrNotFound) {
+		return nil, nil, fmt.Errorf("key %q %w", key, imds.ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, describeError(client, key, err)
+	}
+	return resp, nil, nil
+}
+
+// jsonValue returns a value as it appears in imds --json: JSON documents
+// decoded, newline-separated values as lists and others as strings.
+func jsonValue(resp []byte) any {
+	if js := tryParseJSON(string(resp)); js != nil {
+		return js
+	}
+	s := strings.TrimSpace(string(resp))
+	if strings.Contains(s, "\n") {
+		return strings.Split(s, "\n")
+	}
+	return s
+}
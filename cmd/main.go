@@ -17,15 +17,21 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/bwagner5/imds/pkg/cassette"
+	"github.com/bwagner5/imds/pkg/format"
 	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/mock"
+	"github.com/bwagner5/imds/pkg/snapshot"
 	"github.com/bwagner5/imds/pkg/tui"
 )
 
@@ -36,15 +42,30 @@ var (
 
 type Options struct {
 	Endpoint  string
+	Mode      string
+	From      string
+	Record    string
+	Replay    string
+	Timeout   time.Duration
+	Attempts  int
+	TokenTTL  time.Duration
+	NoConfig  bool
 	Recursive bool
 	Dump      bool
+	Annotate  bool
 	JSON      bool
+	Output    string
 	Watch     bool
+	Quiet     bool
+	Query     string
 	Version   bool
 }
 
 var opts = &Options{}
 
+// recorder records the interactions of every client when --record is set.
+var recorder *cassette.Recorder
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -56,10 +77,18 @@ func main() {
 		Example: `  imds                    # Launch interactive TUI
   imds instance-id        # Get specific value
   imds placement/region   # Get nested value
+  imds instance-id region az -o env  # Get several values
   imds -r                 # Tree view of all keys
   imds --dump             # Dump all keys with values
-  imds spot --dump        # Dump specific path`,
+  imds spot --dump        # Dump specific path
+  imds --from snapshot.json -r  # Tree view of a snapshot
+  imds placement --output yaml  # Path in another format
+  imds --dump --annotate  # Dump as YAML with documentation comments
+  imds --query 'network.interfaces.macs.*.vpc-id'  # Select with a path expression`,
 		Args: cobra.ArbitraryArgs,
+		// main prints errors, so they go to stderr once without usage.
+		SilenceErrors: true,
+		SilenceUsage:  true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if opts.Version {
 				fmt.Printf("Version: %s\nCommit: %s\n", version, commit)
@@ -69,32 +98,120 @@ func main() {
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&opts.Endpoint, "endpoint", "e", envOr("IMDS_ENDPOINT", imds.DefaultEndpoint), "IMDS endpoint")
+	rootCmd.PersistentFlags().StringVarP(&opts.Endpoint, "endpoint", "e", envOr("IMDS_ENDPOINT", imds.DefaultEndpoint), "IMDS endpoint")
+	rootCmd.PersistentFlags().StringVar(&opts.Mode, "endpoint-mode", envOr("IMDS_ENDPOINT_MODE", "auto"), "IMDS address family: auto (from --endpoint), ipv4 or ipv6 (falls back to IPv4 if unreachable)")
+	rootCmd.PersistentFlags().StringVar(&opts.Record, "record", "", "Record IMDS interactions to a cassette file")
+	rootCmd.PersistentFlags().StringVar(&opts.Replay, "replay", "", "Answer IMDS requests from a cassette file instead of the network")
+	rootCmd.PersistentFlags().DurationVar(&opts.Timeout, "timeout", 0, "Timeout for each IMDS request including retries (default 5s)")
+	rootCmd.PersistentFlags().IntVar(&opts.Attempts, "max-attempts", 0, "Maximum attempts per IMDS request, 1 disables retries (default 3)")
+	rootCmd.PersistentFlags().DurationVar(&opts.TokenTTL, "token-ttl", 0, "Lifetime to request for IMDSv2 session tokens (default 5m)")
+	rootCmd.PersistentFlags().BoolVar(&opts.NoConfig, "no-shared-config", false, "Do not read ~/.aws config files or AWS_* environment variables")
+	rootCmd.Flags().StringVar(&opts.From, "from", "", "Read metadata from a snapshot or JSON tree file instead of IMDS")
 	rootCmd.Flags().BoolVarP(&opts.Recursive, "recursive", "r", false, "List paths recursively (tree, keys only)")
 	rootCmd.Flags().BoolVarP(&opts.Dump, "dump", "d", false, "Dump all paths with values")
-	rootCmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Output as JSON")
+	rootCmd.Flags().BoolVar(&opts.Annotate, "annotate", false, "With --dump or --output yaml, dump YAML commenting each key with its documentation")
+	rootCmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Output as JSON, the same as --output json")
+	rootCmd.Flags().StringVarP(&opts.Output, "output", "o", "", "Output all paths, or several keys (default table), in a format: "+strings.Join(format.Names(), ", "))
 	rootCmd.Flags().BoolVarP(&opts.Watch, "watch", "w", false, "Watch for changes")
+	rootCmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Do not suggest similar keys or list ambiguous matches")
+	rootCmd.Flags().StringVar(&opts.Query, "query", "", "Select values with a path expression such as 'network.interfaces.macs.*.vpc-id'")
 	rootCmd.Flags().BoolVar(&opts.Version, "version", false, "Show version")
 
-	if err := rootCmd.ExecuteContext(ctx); err != nil {
-		os.Exit(1)
+	rootCmd.AddCommand(newRunCommand(), newDaemonCommand(), newServeCommand(), newMockCommand(), newSnapshotCommand(), newTUICommand(), newDiffCommand(), newDoctorCommand(), newRenderCommand())
+
+	if err := execute(ctx, rootCmd); err != nil {
+		var exitErr *exitCodeError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
+// execute runs the command, then saves the --record cassette even if the
+// command failed, as the failing exchange is usually the one worth replaying.
+func execute(ctx context.Context, rootCmd *cobra.Command) (err error) {
+	defer func() {
+		if recorder == nil {
+			return
+		}
+		serr := recorder.Cassette().Save(opts.Record)
+		switch {
+		case serr == nil:
+		case err == nil:
+			err = fmt.Errorf("saving cassette: %w", serr)
+		default:
+			// Keep the command's error and exit code.
+			fmt.Fprintln(os.Stderr, "Error: saving cassette:", serr)
+		}
+	}()
+	return rootCmd.ExecuteContext(ctx)
+}
+
 func run(ctx context.Context, args []string) error {
-	client, err := imds.NewClient(ctx, opts.Endpoint)
+	if opts.Query != "" {
+		switch {
+		case len(args) > 0:
+			return fmt.Errorf("--query cannot be combined with a path")
+		case opts.Dump || opts.Recursive || opts.Watch || opts.Annotate || opts.Output != "":
+			return fmt.Errorf("--query cannot be combined with --dump, --recursive, --watch, --annotate or --output")
+		}
+		client, err := newBackend(ctx)
+		if err != nil {
+			return err
+		}
+		return selectQuery(ctx, client, opts.Query)
+	}
+	output := opts.Output
+	if opts.JSON {
+		output = "json"
+	}
+	var formatter format.Formatter
+	switch {
+	case opts.Annotate:
+		if !opts.Dump && output != "yaml" {
+			return fmt.Errorf("--annotate requires --dump or --output yaml")
+		}
+		formatter = format.FormatterFunc(format.AnnotatedYAML)
+	case output != "":
+		var err error
+		if formatter, err = format.Lookup(output); err != nil {
+			return err
+		}
+	}
+	client, err := newBackend(ctx)
 	if err != nil {
-		return fmt.Errorf("creating client: %w", err)
+		return err
 	}
 
 	path := strings.Join(args, "/")
 
-	// JSON flag always dumps all data as JSON
-	if opts.JSON {
-		data := client.GetAll(ctx, imds.NormalizePath(path))
-		enc, _ := json.MarshalIndent(data, "", "  ")
-		fmt.Println(string(enc))
-		return nil
+	if opts.Watch {
+		if formatter == nil {
+			formatter = format.FormatterFunc(format.JSON)
+		}
+		return watch(ctx, client, imds.NormalizePath(path), formatter)
+	}
+
+	// An output format dumps all data below path, or the keys given if there
+	// are several or the one given is not a path.
+	if formatter != nil {
+		if len(args) > 1 && !opts.Dump {
+			return queryKeys(ctx, client, args, formatter)
+		}
+		if len(args) == 1 && !opts.Dump {
+			if _, err := client.Get(ctx, imds.NormalizePath(path)); errors.Is(err, imds.ErrNotFound) {
+				return queryKeys(ctx, client, args, formatter)
+			}
+		}
+		data, err := getAll(ctx, client, imds.NormalizePath(path))
+		if data == nil {
+			return err
+		}
+		if ferr := formatter.Format(os.Stdout, data); ferr != nil {
+			return ferr
+		}
+		return err
 	}
 
 	// Launch TUI if no args and no output flags
@@ -102,48 +219,161 @@ func run(ctx context.Context, args []string) error {
 		return tui.Run(ctx, client)
 	}
 
-	if opts.Watch {
-		return watch(ctx, client, imds.NormalizePath(path))
-	}
-
 	if opts.Dump || opts.Recursive {
 		return dumpOrTree(ctx, client, imds.NormalizePath(path))
 	}
 
-	return query(ctx, client, path)
+	// Several keys are looked up independently.
+	if len(args) > 1 {
+		table, err := format.Lookup("table")
+		if err != nil {
+			return err
+		}
+		return queryKeys(ctx, client, args, table)
+	}
+
+	return queryKey(ctx, client, path)
 }
 
-func query(ctx context.Context, client *imds.Client, path string) error {
-	// Smart lookup for simple keys (no slashes)
-	if !strings.Contains(path, "/") {
-		if found := client.FindKey(ctx, path); found != "" {
-			resp, err := client.Get(ctx, found)
-			if err == nil && !imds.IsDirectory(resp) {
-				return output(resp)
-			}
+// newClient creates a client for endpoint configured by the global flags,
+// recording or replaying its interactions when --record or --replay is set.
+func newClient(ctx context.Context, endpoint string) (*imds.Client, error) {
+	mode, err := imds.ParseEndpointMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+	clientOpts := []imds.Option{
+		imds.WithEndpointMode(mode),
+		imds.WithTimeout(opts.Timeout),
+		imds.WithMaxAttempts(opts.Attempts),
+		imds.WithTokenTTL(opts.TokenTTL),
+	}
+	if version != "" {
+		clientOpts = append(clientOpts, imds.WithUserAgent("imds-cli/"+version))
+	}
+	if opts.NoConfig {
+		clientOpts = append(clientOpts, imds.WithoutSharedConfig())
+	}
+	switch {
+	case opts.Replay != "":
+		c, err := cassette.Load(opts.Replay)
+		if err != nil {
+			return nil, err
 		}
+		clientOpts = append(clientOpts, imds.WithTransport(cassette.NewReplayer(c)))
+	case opts.Record != "":
+		if recorder == nil {
+			recorder = cassette.NewRecorder(nil, nil)
+		}
+		clientOpts = append(clientOpts, imds.WithTransport(recorder))
+	}
+	return imds.NewClient(ctx, endpoint, clientOpts...)
+}
+
+// newBackend returns the metadata source selected by --from, or live IMDS at --endpoint.
+func newBackend(ctx context.Context) (imds.Backend, error) {
+	if opts.From != "" {
+		return loadBackend(opts.From)
+	}
+	client, err := newClient(ctx, opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	if err := probe(ctx, client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// probe fails fast with an explanation when IMDS is not available, rather
+// than letting commands wait through retries. Replayed sessions are not probed.
+func probe(ctx context.Context, client *imds.Client) error {
+	if opts.Replay != "" {
+		return nil
+	}
+	result := client.Probe(ctx, imds.ProbeOptions{Timeout: opts.Timeout})
+	switch result.Environment {
+	case imds.EnvironmentNotEC2:
+		return fmt.Errorf("not running on EC2: nothing answers at %s; use --endpoint for a mock IMDS or --from for a snapshot: %w", client.Endpoint(), result.Err)
+	case imds.EnvironmentUnreachable:
+		return fmt.Errorf("IMDS at %s did not answer; it may be disabled, or in a container the hop limit may be too low: %w", client.Endpoint(), result.Err)
 	}
+	return nil
+}
 
-	resp, err := client.Get(ctx, imds.NormalizePath(path))
+// loadBackend reads a snapshot written by imds snapshot, or a JSON tree such
+// as the output of imds --json.
+func loadBackend(path string) (imds.Backend, error) {
+	snap, err := snapshot.Load(path)
+	if err == nil {
+		return snap, nil
+	}
+	if !errors.Is(err, snapshot.ErrNotSnapshot) {
+		return nil, err
+	}
+	tree, err := mock.LoadTree(path)
 	if err != nil {
-		keys := client.AllKeys(ctx)
-		similar := imds.FindSimilar(path, keys, 5)
-		if len(similar) > 0 {
-			fmt.Fprintf(os.Stderr, "Key %q not found. Did you mean:\n", path)
-			for _, s := range similar {
-				fmt.Fprintf(os.Stderr, "  - %s\n", s)
+		return nil, err
+	}
+	return imds.NewMemory(tree), nil
+}
+
+func queryKey(ctx context.Context, client imds.Backend, path string) error {
+	resp, matches, err := lookup(ctx, client, client, path)
+	switch {
+	case errors.Is(err, errAmbiguous):
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "Key %q matches %d paths:\n", path, len(matches))
+			for _, m := range matches {
+				fmt.Fprintf(os.Stderr, "  - %s\n", m)
 			}
-			return nil
 		}
-		return fmt.Errorf("key %q not found", path)
+		return err
+	case errors.Is(err, imds.ErrNotFound):
+		if !opts.Quiet {
+			keys := imds.AllKeys(ctx, client)
+			if similar := imds.FindSimilar(path, keys, 5); len(similar) > 0 {
+				fmt.Fprintln(os.Stderr, "Did you mean:")
+				for _, s := range similar {
+					fmt.Fprintf(os.Stderr, "  - %s\n", s)
+				}
+			}
+		}
+		return err
+	case err != nil:
+		return err
 	}
 	return output(resp)
 }
 
+// describeError explains why a request for path failed, for errors other than
+// the path not existing.
+func describeError(client imds.Backend, path string, err error) error {
+	var imdsErr *imds.Error
+	if !errors.As(err, &imdsErr) {
+		return err
+	}
+	endpoint := opts.Endpoint
+	if c, ok := client.(*imds.Client); ok {
+		endpoint = c.Endpoint()
+	}
+	switch {
+	case errors.Is(err, imds.ErrUnreachable):
+		return fmt.Errorf("IMDS is unreachable at %s; not running on EC2, or the metadata service is disabled: %w", endpoint, err)
+	case errors.Is(err, imds.ErrTokenUnavailable):
+		return fmt.Errorf("IMDSv2 is required but no session token could be obtained; in a container, the instance's metadata hop limit may be too low: %w", err)
+	case errors.Is(err, imds.ErrUnauthorized):
+		return fmt.Errorf("IMDS refused the request for %q (status %d); the session token was rejected or access is blocked: %w", path, imdsErr.Status, err)
+	case errors.Is(err, imds.ErrThrottled):
+		return fmt.Errorf("IMDS throttled the request for %q; retry later or make fewer requests: %w", path, err)
+	}
+	return fmt.Errorf("reading %q: %w", path, err)
+}
+
 func output(resp []byte) error {
 	var js any
 	if json.Unmarshal(resp, &js) == nil {
-		enc, _ := json.MarshalIndent(js, "", "  ")
+		enc, _ := imds.MarshalIndent(js, "", "  ")
 		fmt.Println(string(enc))
 		return nil
 	}
@@ -151,21 +381,51 @@ func output(resp []byte) error {
 	return nil
 }
 
-func dumpOrTree(ctx context.Context, client *imds.Client, path string) error {
-	data := client.GetAll(ctx, path)
+func dumpOrTree(ctx context.Context, client imds.Backend, path string) error {
+	data, err := getAll(ctx, client, path)
+	if data == nil {
+		return err
+	}
 
 	if opts.Dump {
 		printDump(data, 0)
 	} else {
 		printTree(data, 0)
 	}
-	return nil
+	return err
 }
 
-func watch(ctx context.Context, client *imds.Client, path string) error {
+// getAll returns the tree below path. For live IMDS, an error wrapping
+// errPartial is returned along with the tree if parts of it could not be
+// read, and a nil tree if none of it could.
+func getAll(ctx context.Context, client imds.Backend, path string) (map[string]any, error) {
+	c, ok := client.(*imds.Client)
+	if !ok {
+		return client.GetAll(ctx, path), nil
+	}
+	data, err := c.Crawl(ctx, path)
+	if err == nil {
+		return data, nil
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	if len(data) == 0 {
+		var imdsErr *imds.Error
+		if errors.As(errs[0], &imdsErr) {
+			path = imdsErr.Path
+		}
+		return nil, describeError(client, path, errs[0])
+	}
+	return data, fmt.Errorf("%w: %d path(s) could not be read, including %w", errPartial, len(errs), errs[0])
+}
+
+func watch(ctx context.Context, client imds.Backend, path string, formatter format.Formatter) error {
 	for data := range client.Watch(ctx, path) {
-		enc, _ := json.MarshalIndent(data, "", "  ")
-		fmt.Println(string(enc))
+		if err := formatter.Format(os.Stdout, data); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -176,7 +436,8 @@ func printTree(data any, depth int) {
 		return
 	}
 	indent := strings.Repeat("  ", depth)
-	for key, val := range m {
+	for _, key := range imds.SortedKeys(m) {
+		val := m[key]
 		if _, isMap := val.(map[string]any); isMap {
 			fmt.Printf("%s%s/\n", indent, key)
 			printTree(val, depth+1)
@@ -192,8 +453,8 @@ func printDump(data any, depth int) {
 		return
 	}
 	indent := strings.Repeat("  ", depth)
-	for key, val := range m {
-		switch v := val.(type) {
+	for _, key := range imds.SortedKeys(m) {
+		switch v := m[key].(type) {
 		case map[string]any:
 			fmt.Printf("%s%s/\n", indent, key)
 			printDump(v, depth+1)
@@ -234,7 +495,8 @@ func printValue(data any, depth int) {
 	indent := strings.Repeat("  ", depth)
 	switch v := data.(type) {
 	case map[string]any:
-		for key, val := range v {
+		for _, key := range imds.SortedKeys(v) {
+			val := v[key]
 			switch inner := val.(type) {
 			case map[string]any:
 				fmt.Printf("%s%s/\n", indent, key)
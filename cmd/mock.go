@@ -0,0 +1,154 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+type MockOptions struct {
+	From         string
+	Scenario     string
+	Faults       string
+	Listen       string
+	RequireToken bool
+}
+
+func newMockCommand() *cobra.Command {
+	mockOpts := &MockOptions{}
+	cmd := &cobra.Command{
+		Use:   "mock --from snapshot.json",
+		Short: "Serve a fake IMDS from a metadata snapshot",
+		Long: `Serve an IMDSv2-compatible endpoint from a snapshot written by 'imds snapshot', or a JSON
+metadata tree in the shape produced by 'imds --json', so the CLI, TUI and SDK-based applications can be run off EC2.
+
+A scenario file changes the tree over time, e.g. to issue a spot interruption after 30s or
+rotate credentials every 5m. Scenario steps can also be run on demand, and any value set or
+deleted, through the admin API under /_admin.
+
+A faults file injects latency, throttling, dropped connections and token problems, globally or
+per path, to exercise client retries and error handling. Faults can be replaced at runtime
+through the admin API.`,
+		Example: `  imds snapshot -o snapshot.json          # on an EC2 instance
+  imds mock --from snapshot.json           # anywhere else
+  imds -e http://127.0.0.1:1338 instance-id
+  imds mock --from snapshot.json --scenario interruption.yaml
+  curl -X POST http://127.0.0.1:1338/_admin/steps/interrupt
+  imds mock --from snapshot.json --faults faults.yaml
+  AWS_EC2_METADATA_SERVICE_ENDPOINT=http://127.0.0.1:1338 ./my-app`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := loadBackend(mockOpts.From)
+			if err != nil {
+				return err
+			}
+			tree := backend.GetAll(cmd.Context(), "")
+			var scenario *mock.Scenario
+			if mockOpts.Scenario != "" {
+				if scenario, err = mock.LoadScenario(mockOpts.Scenario); err != nil {
+					return err
+				}
+			}
+			var faults *mock.Faults
+			if mockOpts.Faults != "" {
+				if faults, err = mock.LoadFaults(mockOpts.Faults); err != nil {
+					return err
+				}
+			}
+			server := mock.New(tree, mock.Options{RequireToken: mockOpts.RequireToken, Faults: faults})
+			runner := mock.NewRunner(server, scenario)
+			go func() { _ = runner.Run(cmd.Context()) }()
+
+			mux := http.NewServeMux()
+			mux.Handle(mock.AdminPrefix+"/", http.StripPrefix(mock.AdminPrefix, runner))
+			mux.Handle("/", server)
+			return listenAndServe(cmd.Context(), mockOpts.Listen, mux)
+		},
+	}
+	cmd.Flags().StringVar(&mockOpts.From, "from", "", "Snapshot or JSON metadata tree to serve, e.g. the output of imds snapshot or imds --json")
+	cmd.Flags().StringVar(&mockOpts.Scenario, "scenario", "", "YAML file of timed changes to apply to the tree")
+	cmd.Flags().StringVar(&mockOpts.Faults, "faults", "", "YAML file of faults to inject")
+	cmd.Flags().StringVar(&mockOpts.Listen, "listen", mock.DefaultListen, "Address to listen on")
+	cmd.Flags().BoolVar(&mockOpts.RequireToken, "require-token", false, "Reject requests without a session token (IMDSv2 only)")
+	_ = cmd.MarkFlagRequired("from")
+	cmd.AddCommand(newMockGenerateCommand())
+	return cmd
+}
+
+type GenerateOptions struct {
+	Shape  mock.Shape
+	Tags   []string
+	Output string
+}
+
+func newMockGenerateCommand() *cobra.Command {
+	genOpts := &GenerateOptions{}
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate a synthetic metadata tree for an instance shape",
+		Long: `Generate a realistic metadata tree, in the shape produced by 'imds --json', for any instance
+type, region, availability zone and network layout. Values agree across keys: MACs match the network
+interfaces, the zone is in the region and the identity document describes the same instance.
+The same flags and --seed always generate the same tree.`,
+		Example: `  imds mock generate -o tree.json
+  imds mock generate --instance-type m6g.xlarge --region eu-west-1 --az eu-west-1b --enis 2 --ipv6 -o tree.json
+  imds mock generate --spot --iam-role my-role --tag Name=web --tag env=prod -o tree.json
+  imds mock --from tree.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tags, err := mock.ParseTags(genOpts.Tags)
+			if err != nil {
+				return err
+			}
+			genOpts.Shape.Tags = tags
+			tree, err := mock.Generate(genOpts.Shape)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if genOpts.Output != "" && genOpts.Output != "-" {
+				f, err := os.Create(genOpts.Output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(tree)
+		},
+	}
+	cmd.Flags().StringVar(&genOpts.Shape.InstanceType, "instance-type", "m5.large", "Instance type")
+	cmd.Flags().StringVar(&genOpts.Shape.Region, "region", "us-east-1", "Region")
+	cmd.Flags().StringVar(&genOpts.Shape.AvailabilityZone, "az", "", "Availability zone (default the region's \"a\" zone)")
+	cmd.Flags().IntVar(&genOpts.Shape.ENIs, "enis", 1, "Number of network interfaces")
+	cmd.Flags().BoolVar(&genOpts.Shape.IPv6, "ipv6", false, "Assign IPv6 addresses")
+	cmd.Flags().BoolVar(&genOpts.Shape.Spot, "spot", false, "Generate a spot instance instead of on-demand")
+	cmd.Flags().StringArrayVar(&genOpts.Tags, "tag", nil, "Instance tag as key=value (repeatable)")
+	cmd.Flags().StringVar(&genOpts.Shape.IAMRole, "iam-role", "", "IAM role to generate an instance profile and credentials for")
+	cmd.Flags().StringVar(&genOpts.Shape.UserData, "user-data", "", "User data")
+	cmd.Flags().Uint64Var(&genOpts.Shape.Seed, "seed", 0, "Seed for generated IDs and addresses")
+	cmd.Flags().StringVarP(&genOpts.Output, "output", "o", "-", "File to write the tree to, - for stdout")
+	return cmd
+}
@@ -0,0 +1,68 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/query"
+)
+
+// selectQuery prints the values the --query expression selects, one per line
+// or as a JSON array with --json. Directories and documents print as JSON.
+func selectQuery(ctx context.Context, client imds.Backend, expr string) error {
+	q, err := query.Parse(expr)
+	if err != nil {
+		return err
+	}
+	values, err := q.Run(ctx, func(ctx context.Context, path string) (map[string]any, error) {
+		return getAll(ctx, client, path)
+	})
+	if len(values) == 0 {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("query %q matched nothing: %w", expr, imds.ErrNotFound)
+	}
+
+	if opts.JSON {
+		data, _ := imds.MarshalIndent(values, "", "  ")
+		fmt.Println(string(data))
+		return err
+	}
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			fmt.Println(v)
+		case []any:
+			// Lists of strings print as IMDS serves them, one item per line.
+			for _, item := range v {
+				if str, ok := item.(string); ok {
+					fmt.Println(str)
+				} else {
+					data, _ := json.Marshal(item)
+					fmt.Println(string(data))
+				}
+			}
+		default:
+			data, _ := imds.MarshalIndent(v, "", "  ")
+			fmt.Println(string(data))
+		}
+	}
+	return err
+}
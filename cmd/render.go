@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/render"
+)
+
+type RenderOptions struct {
+	Template string
+	Output   string
+}
+
+func newRenderCommand() *cobra.Command {
+	renderOpts := &RenderOptions{}
+	cmd := &cobra.Command{
+		Use:   "render --template file.tmpl",
+		Short: "Render a Go template with instance metadata",
+		Long: `Execute a Go text/template against the metadata tree, e.g. to generate a config file. The
+tree is the template's data, and these functions are available:
+
+  key "region"                  value of a key found by name, as in 'imds region'
+  get "placement/region"        value at a path
+  default "none" (key "ipv6")   the value, or the default if it is empty
+  required "msg" (key "ipv6")   the value, or fail with msg if it is empty
+  document                      the instance identity document
+  fromJSON, toJSON              decode or encode JSON
+  tag "Name", tags              instance tags, if tags are allowed in metadata
+  join "," (get "meta-data/security-groups")
+  cidrHost, cidrNetmask, cidrContains, cidrSubnet
+
+With --output, the file is replaced atomically, and only if its content changes.`,
+		Example: `  imds render --template app.conf.tmpl
+  imds render --template app.conf.tmpl --output /etc/app.conf
+  imds render --from snapshot.json --template app.conf.tmpl`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			text, err := os.ReadFile(renderOpts.Template)
+			if err != nil {
+				return err
+			}
+			backend, err := newBackend(cmd.Context())
+			if err != nil {
+				return err
+			}
+			data, err := render.Render(cmd.Context(), backend, filepath.Base(renderOpts.Template), string(text))
+			if err != nil {
+				return err
+			}
+			if renderOpts.Output == "" || renderOpts.Output == "-" {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+			changed, err := render.WriteFile(renderOpts.Output, data, 0o644)
+			if err != nil {
+				return err
+			}
+			if changed {
+				fmt.Fprintf(os.Stderr, "Wrote %s\n", renderOpts.Output)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&renderOpts.Template, "template", "t", "", "Go template file to render")
+	cmd.Flags().StringVarP(&renderOpts.Output, "output", "o", "-", "File to write, replaced only if its content changes, - for stdout")
+	cmd.Flags().StringVar(&opts.From, "from", "", "Read metadata from a snapshot or JSON tree file instead of IMDS")
+	_ = cmd.MarkFlagRequired("template")
+	return cmd
+}
@@ -0,0 +1,89 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/supervisor"
+)
+
+type RunOptions struct {
+	Signal          string
+	PollInterval    time.Duration
+	KillBefore      time.Duration
+	DeadlineFile    string
+	IgnoreRebalance bool
+}
+
+func newRunCommand() *cobra.Command {
+	runOpts := &RunOptions{}
+	cmd := &cobra.Command{
+		Use:   "run -- <command> [args...]",
+		Short: "Run a command and forward spot interruptions to it as a signal",
+		Long: `Run a command and poll IMDS for spot interruption notices and rebalance recommendations.
+When a notice appears the configured signal is sent to the command's process group and the
+notice is written as JSON to the file named by $` + supervisor.DeadlineFileEnv + `. The command is
+sent SIGKILL shortly before the spot termination time. The command's exit code is passed through.`,
+		Example: `  imds run -- ./batch-job
+  imds run --signal USR1 --kill-before 15s -- python train.py`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sig, err := supervisor.ParseSignal(runOpts.Signal)
+			if err != nil {
+				return err
+			}
+			client, err := newClient(cmd.Context(), opts.Endpoint)
+			if err != nil {
+				return fmt.Errorf("creating client: %w", err)
+			}
+			sup := supervisor.New(client, supervisor.Options{
+				Signal:          sig,
+				PollInterval:    runOpts.PollInterval,
+				KillBefore:      runOpts.KillBefore,
+				DeadlineFile:    runOpts.DeadlineFile,
+				IgnoreRebalance: runOpts.IgnoreRebalance,
+			})
+			code, err := sup.Run(cmd.Context(), args[0], args[1:]...)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &exitCodeError{code: code}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&runOpts.Signal, "signal", "TERM", "Signal sent to the command when a notice appears")
+	cmd.Flags().DurationVar(&runOpts.PollInterval, "poll-interval", supervisor.DefaultPollInterval, "How often to poll IMDS for notices")
+	cmd.Flags().DurationVar(&runOpts.KillBefore, "kill-before", supervisor.DefaultKillBefore, "Send SIGKILL this long before the spot termination time")
+	cmd.Flags().StringVar(&runOpts.DeadlineFile, "deadline-file", "", "File the notice is written to (default: a temporary file)")
+	cmd.Flags().BoolVar(&runOpts.IgnoreRebalance, "ignore-rebalance", false, "Do not signal on rebalance recommendations")
+	return cmd
+}
+
+// exitCodeError makes the process exit with code without printing anything.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
@@ -0,0 +1,190 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/firewall"
+	"github.com/bwagner5/imds/pkg/health"
+	"github.com/bwagner5/imds/pkg/proxy"
+)
+
+type ServeOptions struct {
+	Health                string
+	HealthSpot            bool
+	HealthRebalance       bool
+	HealthLifecycleStates []string
+	HealthPollInterval    time.Duration
+	Proxy                 string
+	ProxyTTL              time.Duration
+	ProxyRequireToken     bool
+	Firewall              string
+	FirewallPolicy        string
+	FirewallAuditLog      string
+}
+
+func newServeCommand() *cobra.Command {
+	serveOpts := &ServeOptions{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve IMDS-derived endpoints over HTTP",
+		Long: `Serve HTTP endpoints backed by IMDS.
+
+--health serves /healthz, which returns 200 normally and 503 with a JSON reason once the
+instance is being reclaimed, so load balancers can drain it before termination.
+
+--proxy serves an IMDS-compatible endpoint that issues its own session tokens and caches
+responses, so containers that cannot reach IMDS (e.g. with a hop limit of 1) can use it.
+Immutable keys such as instance-id are cached indefinitely and others for --proxy-ttl.
+
+--firewall serves the proxy behind per-client policies keyed by source CIDR or, on a Unix
+socket, peer UID. Credentials are denied unless a policy allows them. Every request is
+written to the audit log as a JSON line.`,
+		Example: `  imds serve --health :8080
+  imds serve --health :8080 --health-rebalance --health-lifecycle-states Terminated
+  imds serve --proxy 172.17.0.1:1338 --proxy-ttl 10s
+  imds serve --firewall unix:/run/imds.sock --firewall-policy policy.yaml --firewall-audit-log audit.log`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if serveOpts.Health == "" && serveOpts.Proxy == "" && serveOpts.Firewall == "" {
+				return errors.New("nothing to serve, specify --health, --proxy or --firewall")
+			}
+			ctx := cmd.Context()
+			client, err := newClient(ctx, opts.Endpoint)
+			if err != nil {
+				return fmt.Errorf("creating client: %w", err)
+			}
+
+			handlers := map[string]http.Handler{}
+			if serveOpts.Health != "" {
+				checker := health.NewChecker(client, health.Options{
+					PollInterval:    serveOpts.HealthPollInterval,
+					Spot:            serveOpts.HealthSpot,
+					Rebalance:       serveOpts.HealthRebalance,
+					LifecycleStates: serveOpts.HealthLifecycleStates,
+				})
+				checker.Check(ctx)
+				go checker.Run(ctx)
+				mux := http.NewServeMux()
+				mux.Handle("/healthz", checker)
+				handlers[serveOpts.Health] = mux
+			}
+			proxyOpts := proxy.Options{TTL: serveOpts.ProxyTTL, RequireToken: serveOpts.ProxyRequireToken}
+			if serveOpts.Proxy != "" {
+				if _, ok := handlers[serveOpts.Proxy]; ok {
+					return errors.New("--proxy must listen on a different address than --health")
+				}
+				handlers[serveOpts.Proxy] = proxy.New(client, proxyOpts)
+			}
+			if serveOpts.Firewall != "" {
+				if _, ok := handlers[serveOpts.Firewall]; ok {
+					return errors.New("--firewall must listen on a different address than --health and --proxy")
+				}
+				cfg := &firewall.Config{}
+				if serveOpts.FirewallPolicy != "" {
+					if cfg, err = firewall.LoadConfig(serveOpts.FirewallPolicy); err != nil {
+						return err
+					}
+				} else if err := cfg.Validate(); err != nil {
+					return err
+				}
+				audit := os.Stderr
+				if serveOpts.FirewallAuditLog != "-" {
+					if audit, err = os.OpenFile(serveOpts.FirewallAuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600); err != nil {
+						return fmt.Errorf("opening audit log: %w", err)
+					}
+					defer audit.Close()
+				}
+				handlers[serveOpts.Firewall] = firewall.New(cfg, proxy.New(client, proxyOpts), audit)
+			}
+			return serveAll(ctx, handlers)
+		},
+	}
+	cmd.Flags().StringVar(&serveOpts.Health, "health", "", "Address to serve /healthz on, e.g. :8080")
+	cmd.Flags().BoolVar(&serveOpts.HealthSpot, "health-spot", true, "Report unhealthy on spot interruption notices")
+	cmd.Flags().BoolVar(&serveOpts.HealthRebalance, "health-rebalance", false, "Report unhealthy on rebalance recommendations")
+	cmd.Flags().StringSliceVar(&serveOpts.HealthLifecycleStates, "health-lifecycle-states", health.DefaultLifecycleStates, "Target lifecycle states that report unhealthy")
+	cmd.Flags().DurationVar(&serveOpts.HealthPollInterval, "health-poll-interval", health.DefaultPollInterval, "How often to check IMDS")
+	cmd.Flags().StringVar(&serveOpts.Proxy, "proxy", "", "Address to serve the caching IMDS proxy on, e.g. 127.0.0.1:1338")
+	cmd.Flags().DurationVar(&serveOpts.ProxyTTL, "proxy-ttl", proxy.DefaultTTL, "How long the proxy caches mutable keys")
+	cmd.Flags().BoolVar(&serveOpts.ProxyRequireToken, "proxy-require-token", false, "Reject proxy requests without a session token (IMDSv2 only)")
+	cmd.Flags().StringVar(&serveOpts.Firewall, "firewall", "", "Address to serve the metadata firewall on, e.g. 127.0.0.1:1338 or unix:/run/imds.sock")
+	cmd.Flags().StringVar(&serveOpts.FirewallPolicy, "firewall-policy", "", "Firewall policy file (default: deny credentials to every client)")
+	cmd.Flags().StringVar(&serveOpts.FirewallAuditLog, "firewall-audit-log", "-", "File the JSON audit log is appended to, - for stderr")
+	return cmd
+}
+
+// serveAll serves each handler on its address until ctx is cancelled or one of them fails.
+func serveAll(ctx context.Context, handlers map[string]http.Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(handlers))
+	for addr, handler := range handlers {
+		go func() {
+			err := listenAndServe(ctx, addr, handler)
+			cancel()
+			errs <- err
+		}()
+	}
+	var err error
+	for range handlers {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+// listenAndServe serves handler on addr until ctx is cancelled. Addresses
+// prefixed with "unix:" listen on a Unix socket.
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	network := "tcp"
+	if socket, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", socket
+		// Remove a stale socket left behind by a previous run.
+		if fi, err := os.Stat(addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(addr)
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	if cc, ok := handler.(interface {
+		ConnContext(context.Context, net.Conn) context.Context
+	}); ok {
+		server.ConnContext = cc.ConnContext
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	fmt.Fprintf(os.Stderr, "Serving on %s\n", ln.Addr())
+	if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
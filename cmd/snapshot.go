@@ -0,0 +1,88 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/snapshot"
+)
+
+type SnapshotOptions struct {
+	Output   string
+	Redact   []string
+	NoRedact bool
+}
+
+func newSnapshotCommand() *cobra.Command {
+	snapOpts := &SnapshotOptions{}
+	cmd := &cobra.Command{
+		Use:   "snapshot [path]",
+		Short: "Capture the raw IMDS tree to a snapshot file",
+		Long: `Capture every IMDS response below path with its raw bytes and HTTP status, along with the
+capture time, endpoint and imds version. Unlike 'imds --json', a snapshot keeps directory
+structure, the exact bytes of every value and the paths that failed, so it can be served with
+'imds mock --from' or read with the snapshot package.
+
+IAM and identity credentials are redacted unless --no-redact is set.`,
+		Example: `  imds snapshot -o snapshot.json
+  imds snapshot meta-data/placement
+  imds snapshot --redact user-data --redact 'meta-data/public-keys/**' -o snapshot.json`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient(cmd.Context(), opts.Endpoint)
+			if err != nil {
+				return fmt.Errorf("creating client: %w", err)
+			}
+			if err := probe(cmd.Context(), client); err != nil {
+				return err
+			}
+			redact := snapOpts.Redact
+			if !snapOpts.NoRedact {
+				redact = append(append([]string{}, snapshot.DefaultRedact...), redact...)
+			}
+			snap, err := snapshot.Capture(cmd.Context(), client, snapshot.Options{
+				Path:        imds.NormalizePath(strings.Join(args, "/")),
+				Endpoint:    client.Endpoint(),
+				ToolVersion: version,
+				Redact:      redact,
+			})
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if snapOpts.Output != "" && snapOpts.Output != "-" {
+				f, err := os.Create(snapOpts.Output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			return snap.Encode(out)
+		},
+	}
+	cmd.Flags().StringVarP(&snapOpts.Output, "output", "o", "-", "File to write the snapshot to, - for stdout")
+	cmd.Flags().StringArrayVar(&snapOpts.Redact, "redact", nil, "Glob of paths to redact, in addition to credentials (repeatable)")
+	cmd.Flags().BoolVar(&snapOpts.NoRedact, "no-redact", false, "Do not redact credentials")
+	return cmd
+}
@@ -0,0 +1,42 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/bwagner5/imds/pkg/tui"
+)
+
+func newTUICommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Explore metadata in the interactive TUI",
+		Long: `Launch the interactive TUI explorer, the same as running imds without arguments. With --from
+it explores a snapshot or JSON tree file, e.g. for post-mortem inspection of another instance.`,
+		Example: `  imds tui
+  imds tui --from snapshot.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := newBackend(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return tui.Run(cmd.Context(), backend)
+		},
+	}
+	cmd.Flags().StringVar(&opts.From, "from", "", "Read metadata from a snapshot or JSON tree file instead of IMDS")
+	return cmd
+}
@@ -62,4 +62,4 @@ echo "# Suggests: instance-id"
 echo
 
 echo "Note: Most commands require running on an EC2 instance."
-echo "      Use -e flag to specify a custom IMDS endpoint for testing."
+echo "      Use imds mock --from snapshot.json and the -e flag to test elsewhere."
@@ -0,0 +1,105 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	Path      = "/latest/api/token"
+	Header    = "X-Aws-Ec2-Metadata-Token"
+	TTLHeader = "X-Aws-Ec2-Metadata-Token-Ttl-Seconds"
+	MaxTTL    = 6 * time.Hour
+)
+
+// Store issues IMDSv2 session tokens and validates them until they expire.
+type Store struct {
+	now func() time.Time
+
+	mu          sync.Mutex
+	tokens      map[string]time.Time
+	expireAfter time.Duration
+}
+
+// NewStore creates a Store that reads the current time from now.
+func NewStore(now func() time.Time) *Store {
+	return &Store{now: now, tokens: map[string]time.Time{}}
+}
+
+// SetExpireAfter makes tokens expire after d regardless of the TTL clients
+// request and are told, to simulate tokens expiring early. Zero disables it.
+func (s *Store) SetExpireAfter(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireAfter = d
+}
+
+// Issue creates a token valid for ttl.
+func (s *Store) Issue(ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	t := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for tok, expires := range s.tokens {
+		if !now.Before(expires) {
+			delete(s.tokens, tok)
+		}
+	}
+	if s.expireAfter > 0 && s.expireAfter < ttl {
+		ttl = s.expireAfter
+	}
+	s.tokens[t] = now.Add(ttl)
+	return t, nil
+}
+
+// Valid reports whether t was issued by the store and has not expired.
+func (s *Store) Valid(t string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[t]
+	return ok && s.now().Before(expires)
+}
+
+// ServeHTTP handles a token PUT the way IMDS does, responding 400 when the
+// TTL header is missing or out of range.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ttlSeconds, err := strconv.Atoi(r.Header.Get(TTLHeader))
+	if err != nil || ttlSeconds < 1 || time.Duration(ttlSeconds)*time.Second > MaxTTL {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	t, err := s.Issue(time.Duration(ttlSeconds) * time.Second)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(TTLHeader, strconv.Itoa(ttlSeconds))
+	_, _ = w.Write([]byte(t))
+}
@@ -0,0 +1,261 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cassette records IMDS HTTP interactions to a file and replays them,
+// so tests can run against a session captured once on a real instance.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwagner5/imds/internal/glob"
+	"github.com/bwagner5/imds/internal/token"
+)
+
+// Version is the cassette format version written by Recorder.
+const Version = 1
+
+// RedactedValue replaces tokens and secrets in recorded bodies.
+const RedactedValue = "REDACTED"
+
+// DefaultRedact are the paths whose secrets are redacted by default.
+var DefaultRedact = []string{
+	"/latest/meta-data/iam/security-credentials/*",
+	"/latest/meta-data/identity-credentials/ec2/security-credentials/*",
+}
+
+// secretFields are the fields of credential documents that are redacted.
+var secretFields = []string{"AccessKeyId", "SecretAccessKey", "Token"}
+
+// recordedHeaders are the response headers kept in a cassette.
+var recordedHeaders = []string{"Content-Type", token.TTLHeader}
+
+// Cassette is a recorded sequence of IMDS interactions.
+type Cassette struct {
+	Version      int           `json:"version"`
+	RecordedAt   time.Time     `json:"recordedAt"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one request and the response IMDS gave to it.
+type Interaction struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Encoding is "base64" when the body is not valid UTF-8.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if c.Version == 0 || c.Version > Version {
+		return nil, fmt.Errorf("parsing %s: unsupported cassette version %d", path, c.Version)
+	}
+	return c, nil
+}
+
+// Save writes the cassette as indented JSON.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// Recorder is an http.RoundTripper that records every interaction passing
+// through it. Session tokens are always redacted, as are the secret fields of
+// credentials at paths matching Redact.
+type Recorder struct {
+	next   http.RoundTripper
+	redact []string
+
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecorder creates a Recorder sending requests through next, or
+// http.DefaultTransport if next is nil. A nil redact uses DefaultRedact.
+func NewRecorder(next http.RoundTripper, redact []string) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if redact == nil {
+		redact = DefaultRedact
+	}
+	return &Recorder{
+		next:     next,
+		redact:   redact,
+		cassette: &Cassette{Version: Version, RecordedAt: time.Now().UTC()},
+	}
+}
+
+// RoundTrip sends the request and records the response.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{Method: req.Method, Path: req.URL.RequestURI(), Status: resp.StatusCode}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			if interaction.Headers == nil {
+				interaction.Headers = map[string]string{}
+			}
+			interaction.Headers[h] = v
+		}
+	}
+	interaction.setBody(r.redactBody(req.URL.Path, body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	return resp, nil
+}
+
+// Cassette returns a copy of what has been recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *r.cassette
+	c.Interactions = append([]Interaction(nil), r.cassette.Interactions...)
+	return &c
+}
+
+func (r *Recorder) redactBody(path string, body []byte) []byte {
+	if path == token.Path {
+		return []byte(RedactedValue)
+	}
+	for _, g := range r.redact {
+		if !glob.Match(g, path) {
+			continue
+		}
+		doc := map[string]any{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return []byte(RedactedValue)
+		}
+		for _, field := range secretFields {
+			if _, ok := doc[field]; ok {
+				doc[field] = RedactedValue
+			}
+		}
+		redacted, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return []byte(RedactedValue)
+		}
+		return redacted
+	}
+	return body
+}
+
+func (i *Interaction) setBody(body []byte) {
+	if utf8.Valid(body) {
+		i.Body = string(body)
+		return
+	}
+	i.Body = base64.StdEncoding.EncodeToString(body)
+	i.Encoding = "base64"
+}
+
+func (i *Interaction) bytes() ([]byte, error) {
+	if i.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(i.Body)
+	}
+	return []byte(i.Body), nil
+}
+
+// Replayer is an http.RoundTripper that answers requests from a cassette
+// without any network access. Requests are matched by method and path;
+// repeated requests get the recorded responses in order, and the last one
+// once they run out. Unrecorded requests fail.
+type Replayer struct {
+	mu    sync.Mutex
+	byKey map[string][]Interaction
+	next  map[string]int
+}
+
+// NewReplayer creates a Replayer for c.
+func NewReplayer(c *Cassette) *Replayer {
+	r := &Replayer{byKey: map[string][]Interaction{}, next: map[string]int{}}
+	for _, i := range c.Interactions {
+		key := i.Method + " " + i.Path
+		r.byKey[key] = append(r.byKey[key], i)
+	}
+	return r
+}
+
+// RoundTrip answers the request with the next recorded response.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + req.URL.RequestURI()
+	r.mu.Lock()
+	recorded := r.byKey[key]
+	n := r.next[key]
+	if n < len(recorded)-1 {
+		r.next[key]++
+	}
+	r.mu.Unlock()
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("cassette: no recorded response for %s", key)
+	}
+
+	interaction := recorded[n]
+	body, err := interaction.bytes()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	for k, v := range interaction.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
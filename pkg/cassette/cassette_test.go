@@ -0,0 +1,99 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+const testTree = `{
+  "meta-data": {
+    "instance-id": "i-1234567890abcdef0",
+    "iam": {"security-credentials": {"my-role": {"Code": "Success", "AccessKeyId": "ASIAEXAMPLE", "SecretAccessKey": "secret", "Token": "token"}}},
+    "placement": {"availability-zone": "us-east-1a", "region": "us-east-1"},
+    "spot": {"instance-action": {"action": "terminate", "time": "2017-09-18T08:22:00Z"}}
+  },
+  "user-data": "hello"
+}`
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	tree := map[string]any{}
+	if err := json.Unmarshal([]byte(testTree), &tree); err != nil {
+		t.Fatalf("parsing test tree: %v", err)
+	}
+	server := httptest.NewServer(mock.New(tree, mock.Options{RequireToken: true}))
+	defer server.Close()
+
+	recorder := NewRecorder(nil, nil)
+	live, err := imds.NewClient(ctx, server.URL, imds.WithTransport(recorder))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	want := live.GetAll(ctx, "")
+	wantAction, err := live.SpotInstanceAction(ctx)
+	if err != nil {
+		t.Fatalf("SpotInstanceAction() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Cassette().Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	server.Close()
+
+	data, _ := json.Marshal(recorder.Cassette())
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "ASIAEXAMPLE") {
+		t.Errorf("cassette contains credentials: %s", data)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	replayed, err := imds.NewClient(ctx, server.URL, imds.WithTransport(NewReplayer(c)))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	got := replayed.GetAll(ctx, "")
+	creds := got["meta-data"].(map[string]any)["iam"].(map[string]any)["security-credentials"].(map[string]any)
+	if role := creds["my-role"].(map[string]any); role["SecretAccessKey"] != RedactedValue || role["Code"] != "Success" {
+		t.Errorf("replayed credentials = %v, want secrets redacted", role)
+	}
+	delete(creds, "my-role")
+	delete(want["meta-data"].(map[string]any)["iam"].(map[string]any)["security-credentials"].(map[string]any), "my-role")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed GetAll() = %v\nwant %v", got, want)
+	}
+
+	if action, err := replayed.SpotInstanceAction(ctx); err != nil || *action != *wantAction {
+		t.Errorf("replayed SpotInstanceAction() = %+v, %v, want %+v", action, err, wantAction)
+	}
+	if path := imds.FindKey(ctx, replayed, "region"); path != "meta-data/placement/region" {
+		t.Errorf("replayed FindKey(region) = %q", path)
+	}
+	if _, err := replayed.Get(ctx, "meta-data/ami-id"); err == nil {
+		t.Error("Get() of an unrecorded path succeeded")
+	}
+}
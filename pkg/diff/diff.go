@@ -0,0 +1,187 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diff compares metadata trees in the shape of imds.Client.GetAll.
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bwagner5/imds/internal/glob"
+)
+
+// Change operations, named as in JSON Patch.
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+)
+
+// DefaultVolatile are paths expected to differ between instances or over
+// time, such as identifiers, addresses and credentials.
+var DefaultVolatile = []string{
+	"meta-data/ami-launch-index",
+	"meta-data/hostname",
+	"meta-data/iam/security-credentials/**",
+	"meta-data/identity-credentials/**",
+	"meta-data/instance-id",
+	"meta-data/local-hostname",
+	"meta-data/local-ipv4",
+	"meta-data/mac",
+	"meta-data/network/**",
+	"meta-data/public-hostname",
+	"meta-data/public-ipv4",
+	"meta-data/reservation-id",
+	"dynamic/instance-identity/document/instanceId",
+	"dynamic/instance-identity/document/pendingTime",
+	"dynamic/instance-identity/document/privateIp",
+	"dynamic/instance-identity/pkcs7",
+	"dynamic/instance-identity/rsa2048",
+	"dynamic/instance-identity/signature",
+}
+
+// Change is a difference between two trees at a slash-separated path, which
+// continues into JSON documents, e.g. "dynamic/instance-identity/document/region".
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// Options configures Compare.
+type Options struct {
+	// Ignore are globs of paths left out of the comparison, where "*"
+	// matches within one segment and "**" matches any number of segments.
+	Ignore []string
+}
+
+// Compare returns the changes that turn tree a into tree b, sorted by path.
+// Lists are compared as whole values.
+func Compare(a, b map[string]any, opts Options) []Change {
+	var changes []Change
+	compare("", normalize(a), normalize(b), opts, &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func compare(path string, a, b any, opts Options, changes *[]Change) {
+	if path != "" && ignored(opts.Ignore, path) {
+		return
+	}
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	if !aIsMap || !bIsMap {
+		if !reflect.DeepEqual(a, b) {
+			*changes = append(*changes, Change{Op: OpReplace, Path: path, From: a, To: b})
+		}
+		return
+	}
+	for k, av := range am {
+		child := join(path, k)
+		bv, ok := bm[k]
+		switch {
+		case ok:
+			compare(child, av, bv, opts, changes)
+		case !ignored(opts.Ignore, child):
+			*changes = append(*changes, Change{Op: OpRemove, Path: child, From: av})
+		}
+	}
+	for k, bv := range bm {
+		child := join(path, k)
+		if _, ok := am[k]; !ok && !ignored(opts.Ignore, child) {
+			*changes = append(*changes, Change{Op: OpAdd, Path: child, To: bv})
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "/" + key
+}
+
+func ignored(globs []string, path string) bool {
+	for _, g := range globs {
+		if glob.Match(g, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize converts a tree to its JSON form so that, e.g., []string and
+// []any lists from different backends compare equal.
+func normalize(tree map[string]any) any {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return tree
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return tree
+	}
+	return v
+}
+
+// PatchOp is one operation of a JSON Patch (RFC 6902).
+type PatchOp struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+// MarshalJSON encodes the operation, leaving out the value of removals.
+func (p PatchOp) MarshalJSON() ([]byte, error) {
+	if p.Op == OpRemove {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{p.Op, p.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{p.Op, p.Path, p.Value})
+}
+
+// JSONPatch converts changes to a JSON Patch that turns the JSON form of
+// tree a into tree b.
+func JSONPatch(changes []Change) []PatchOp {
+	patch := make([]PatchOp, 0, len(changes))
+	for _, c := range changes {
+		patch = append(patch, PatchOp{Op: c.Op, Path: Pointer(c.Path), Value: c.To})
+	}
+	return patch
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Pointer converts a slash-separated path to a JSON Pointer (RFC 6901).
+func Pointer(path string) string {
+	if path == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, token := range strings.Split(path, "/") {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(token))
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	a := map[string]any{
+		"meta-data": map[string]any{
+			"instance-id":     "i-aaaa",
+			"instance-type":   "m5.large",
+			"security-groups": []string{"default", "web"},
+			"spot":            map[string]any{"instance-action": map[string]any{"action": "stop"}},
+		},
+		"user-data": "hello",
+	}
+	b := map[string]any{
+		"meta-data": map[string]any{
+			"instance-id":     "i-bbbb",
+			"instance-type":   "m5.xlarge",
+			"security-groups": []any{"default", "web"},
+			"spot":            map[string]any{"instance-action": map[string]any{"action": "terminate"}},
+			"tags":            map[string]any{"instance": map[string]any{"env": "prod"}},
+		},
+	}
+
+	got := Compare(a, b, Options{Ignore: DefaultVolatile})
+	want := []Change{
+		{Op: OpReplace, Path: "meta-data/instance-type", From: "m5.large", To: "m5.xlarge"},
+		{Op: OpReplace, Path: "meta-data/spot/instance-action/action", From: "stop", To: "terminate"},
+		{Op: OpAdd, Path: "meta-data/tags", To: map[string]any{"instance": map[string]any{"env": "prod"}}},
+		{Op: OpRemove, Path: "user-data", From: "hello"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() = %+v\nwant %+v", got, want)
+	}
+
+	if got := Compare(a, b, Options{}); len(got) != len(want)+1 || got[0].Path != "meta-data/instance-id" {
+		t.Errorf("Compare() without ignores = %+v, want instance-id change too", got)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	patch := JSONPatch([]Change{
+		{Op: OpAdd, Path: "meta-data/tags/instance/a~b", To: nil},
+		{Op: OpRemove, Path: "user-data", From: "hello"},
+		{Op: OpReplace, Path: "meta-data/instance-type", From: "m5.large", To: "m5.xlarge"},
+	})
+	got, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `[{"op":"add","path":"/meta-data/tags/instance/a~0b","value":null},` +
+		`{"op":"remove","path":"/user-data"},` +
+		`{"op":"replace","path":"/meta-data/instance-type","value":"m5.xlarge"}]`
+	if string(got) != want {
+		t.Errorf("JSONPatch() = %s\nwant %s", got, want)
+	}
+}
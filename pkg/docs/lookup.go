@@ -0,0 +1,95 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docs
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Entry documents an IMDS category.
+type Entry struct {
+	// Path is the category below the IMDS root, e.g. meta-data/ami-id.
+	Path        string
+	Description string
+	// Version is the IMDS version the category appeared in.
+	Version string
+}
+
+// placeholders are the category segments that stand for any name in the
+// directory before them, e.g. the mac in network/interfaces/macs/mac/vpc-id.
+var placeholders = map[string]string{
+	"macs/mac":                       `[0-9a-fA-F]{2}(:[0-9a-fA-F]{2}){5}`,
+	"public-keys/0":                  `[0-9]+(=[^/]*)?`,
+	"security-credentials/role-name": `[^/]+`,
+	"associations/elastic-gpu-id":    `[^/]+`,
+	"associations/eia-id":            `[^/]+`,
+	"ipv4-associations/public-ip":    `[^/]+`,
+}
+
+// indexed matches segments such as ebsN that stand for ebs1, ebs2 and so on.
+var indexed = regexp.MustCompile(`^([a-z]+)N$`)
+
+type pattern struct {
+	re    *regexp.Regexp
+	entry Entry
+}
+
+var patterns = sync.OnceValue(func() []pattern {
+	var list []pattern
+	add := func(root, category, description, version string) {
+		segments := strings.Split(category, "/")
+		parts := make([]string, len(segments))
+		for i, segment := range segments {
+			parent := root
+			if i > 0 {
+				parent = segments[i-1]
+			}
+			switch m := indexed.FindStringSubmatch(segment); {
+			case placeholders[parent+"/"+segment] != "":
+				parts[i] = placeholders[parent+"/"+segment]
+			case m != nil:
+				parts[i] = regexp.QuoteMeta(m[1]) + `[0-9]+`
+			default:
+				parts[i] = regexp.QuoteMeta(segment)
+			}
+		}
+		list = append(list, pattern{
+			re:    regexp.MustCompile("^" + root + "/" + strings.Join(parts, "/") + "$"),
+			entry: Entry{Path: root + "/" + category, Description: description, Version: version},
+		})
+	}
+	for _, e := range InstanceMetadataCategoryEntries {
+		add("meta-data", e.Category, e.Description, e.Version)
+	}
+	for _, e := range DynamicCategoryEntries {
+		add("dynamic", e.Category, e.Description, e.Version)
+	}
+	return list
+})
+
+// Lookup returns the documentation for a concrete path, such as
+// meta-data/block-device-mapping/ebs2 or
+// meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/vpc-id.
+func Lookup(path string) (Entry, bool) {
+	path = strings.Trim(path, "/")
+	for _, p := range patterns() {
+		if p.re.MatchString(path) {
+			return p.entry, true
+		}
+	}
+	return Entry{}, false
+}
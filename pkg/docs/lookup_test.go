@@ -0,0 +1,49 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docs
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"meta-data/ami-id", "meta-data/ami-id"},
+		{"/meta-data/mac/", "meta-data/mac"},
+		{"meta-data/block-device-mapping/ebs2", "meta-data/block-device-mapping/ebsN"},
+		{"meta-data/block-device-mapping/ephemeral10", "meta-data/block-device-mapping/ephemeralN"},
+		{"meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/vpc-id", "meta-data/network/interfaces/macs/mac/vpc-id"},
+		{"meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/mac", "meta-data/network/interfaces/macs/mac/mac"},
+		{"meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/ipv4-associations/3.1.2.4", "meta-data/network/interfaces/macs/mac/ipv4-associations/public-ip"},
+		{"meta-data/iam/security-credentials/my-role", "meta-data/iam/security-credentials/role-name"},
+		{"meta-data/public-keys/1=my-key/openssh-key", "meta-data/public-keys/0/openssh-key"},
+		{"dynamic/instance-identity/document", "dynamic/instance-identity/document"},
+		{"meta-data/network/interfaces/macs/mac/vpc-id", ""},
+		{"meta-data/block-device-mapping/ebsN", ""},
+		{"meta-data/placement", ""},
+		{"dynamic/instance-identity/document/region", ""},
+	}
+	for _, tt := range tests {
+		entry, ok := Lookup(tt.path)
+		if ok != (tt.want != "") || entry.Path != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", tt.path, entry.Path, ok, tt.want)
+			continue
+		}
+		if ok && (entry.Description == "" || entry.Version == "") {
+			t.Errorf("Lookup(%q) = %+v, want a description and version", tt.path, entry)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package doctor diagnoses why IMDS cannot be reached or used, with checks
+// that each come with a remediation hint.
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwagner5/imds/internal/token"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// DefaultTimeout bounds each request made by a check.
+const DefaultTimeout = 2 * time.Second
+
+// SlowLatency is the average latency above which the latency check warns.
+const SlowLatency = 100 * time.Millisecond
+
+// latencySamples is how many requests the latency check averages.
+const latencySamples = 5
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Names of the checks, in the order they run.
+const (
+	CheckProxy           = "proxy"
+	CheckToken           = "token"
+	CheckGetWithToken    = "get-with-token"
+	CheckGetWithoutToken = "get-without-token"
+	CheckIPv4Endpoint    = "ipv4-endpoint"
+	CheckIPv6Endpoint    = "ipv6-endpoint"
+	CheckLatency         = "latency"
+	CheckTags            = "tags"
+	CheckCredentials     = "credentials"
+)
+
+// Check is the result of one diagnostic.
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Hint suggests how to fix a failure or warning.
+	Hint string `json:"hint,omitempty"`
+}
+
+// Report is the result of every check.
+type Report struct {
+	Endpoint string  `json:"endpoint"`
+	Checks   []Check `json:"checks"`
+}
+
+// OK reports whether no check failed.
+func (r *Report) OK() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns the result of the named check.
+func (r *Report) Check(name string) (Check, bool) {
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+// Options configures Run.
+type Options struct {
+	// Endpoint is the IMDS endpoint, imds.DefaultEndpoint if empty.
+	Endpoint string
+	// Timeout bounds each request, DefaultTimeout if zero.
+	Timeout time.Duration
+	// Transport sends the requests, http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Getenv reads proxy settings, os.Getenv if nil.
+	Getenv func(string) string
+}
+
+type doctor struct {
+	opts   Options
+	http   *http.Client
+	report *Report
+	token  string
+}
+
+// Run runs every check against IMDS at opts.Endpoint.
+func Run(ctx context.Context, opts Options) *Report {
+	if opts.Endpoint == "" {
+		opts.Endpoint = imds.DefaultEndpoint
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	if opts.Getenv == nil {
+		opts.Getenv = os.Getenv
+	}
+	d := &doctor{
+		opts:   opts,
+		http:   &http.Client{Transport: opts.Transport, Timeout: opts.Timeout},
+		report: &Report{Endpoint: opts.Endpoint},
+	}
+	d.add(d.checkProxy())
+	d.add(d.checkToken(ctx))
+	d.add(d.checkGetWithToken(ctx))
+	d.add(d.checkGetWithoutToken(ctx))
+	d.add(d.checkEndpoint(ctx, CheckIPv4Endpoint, imds.DefaultEndpoint))
+	d.add(d.checkEndpoint(ctx, CheckIPv6Endpoint, imds.DefaultIPv6Endpoint))
+	d.add(d.checkLatency(ctx))
+
+	client, err := imds.NewClient(ctx, opts.Endpoint, imds.WithoutSharedConfig(), imds.WithTransport(opts.Transport),
+		imds.WithTimeout(opts.Timeout), imds.WithMaxAttempts(1))
+	if err != nil {
+		d.add(Check{Name: CheckTags, Status: StatusSkip, Detail: err.Error()})
+		d.add(Check{Name: CheckCredentials, Status: StatusSkip, Detail: err.Error()})
+		return d.report
+	}
+	d.add(d.checkTags(ctx, client))
+	d.add(d.checkCredentials(ctx, client))
+	return d.report
+}
+
+func (d *doctor) add(c Check) {
+	d.report.Checks = append(d.report.Checks, c)
+}
+
+// do sends a request to endpoint and returns the response and its body, or an
+// error if no response was received.
+func (d *doctor) do(ctx context.Context, method, endpoint, path, tok string) (*http.Response, []byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if method == http.MethodPut {
+		req.Header.Set(token.TTLHeader, "21600")
+	}
+	if tok != "" {
+		req.Header.Set(token.Header, tok)
+	}
+	start := time.Now()
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, nil, time.Since(start), err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, time.Since(start), err
+}
+
+func (d *doctor) checkProxy() Check {
+	c := Check{Name: CheckProxy, Status: StatusPass, Detail: "no HTTP proxy configured"}
+	var proxies []string
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"} {
+		if d.opts.Getenv(name) != "" {
+			proxies = append(proxies, name)
+		}
+	}
+	if len(proxies) == 0 {
+		return c
+	}
+	host := hostname(d.opts.Endpoint)
+	if excluded(d.opts.Getenv("NO_PROXY")+","+d.opts.Getenv("no_proxy"), host) {
+		c.Detail = fmt.Sprintf("%s set, %s excluded by NO_PROXY", strings.Join(proxies, ", "), host)
+		return c
+	}
+	c.Status = StatusWarn
+	c.Detail = fmt.Sprintf("%s set without excluding %s in NO_PROXY", strings.Join(proxies, ", "), host)
+	c.Hint = fmt.Sprintf("IMDS requests may be sent to the proxy, which cannot reach IMDS; add %s to NO_PROXY", host)
+	return c
+}
+
+// excluded reports whether a NO_PROXY list excludes host, by name, "*" or CIDR.
+func excluded(noProxy, host string) bool {
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || strings.Trim(entry, "[]") == host {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostname(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Hostname()
+}
+
+func (d *doctor) checkToken(ctx context.Context) Check {
+	c := Check{Name: CheckToken}
+	resp, body, latency, err := d.do(ctx, http.MethodPut, d.opts.Endpoint, token.Path, "")
+	switch {
+	case err != nil:
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("no response to the token PUT: %v", err)
+		c.Hint = "in a container, the PUT response may be dropped by the hop limit; raise it with " +
+			"aws ec2 modify-instance-metadata-options --instance-id <id> --http-put-response-hop-limit 2"
+	case resp.StatusCode == http.StatusOK:
+		d.token = strings.TrimSpace(string(body))
+		c.Status = StatusPass
+		c.Detail = fmt.Sprintf("session token issued in %s", latency.Round(time.Microsecond))
+	case resp.StatusCode == http.StatusForbidden:
+		c.Status = StatusFail
+		c.Detail = "token PUT refused (status 403)"
+		c.Hint = "IMDS refuses token requests carrying X-Forwarded-For, e.g. through a proxy, and all requests when the " +
+			"metadata service is disabled: aws ec2 modify-instance-metadata-options --instance-id <id> --http-endpoint enabled"
+	default:
+		c.Status = StatusWarn
+		c.Detail = fmt.Sprintf("token PUT returned status %d, so IMDSv2 is not supported", resp.StatusCode)
+		c.Hint = "clients fall back to IMDSv1"
+	}
+	return c
+}
+
+func (d *doctor) checkGetWithToken(ctx context.Context) Check {
+	c := Check{Name: CheckGetWithToken}
+	if d.token == "" {
+		c.Status = StatusSkip
+		c.Detail = "no session token"
+		return c
+	}
+	resp, _, latency, err := d.do(ctx, http.MethodGet, d.opts.Endpoint, "/latest/meta-data/instance-id", d.token)
+	switch {
+	case err != nil:
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("no response: %v", err)
+	case resp.StatusCode == http.StatusOK:
+		c.Status = StatusPass
+		c.Detail = fmt.Sprintf("meta-data/instance-id read in %s", latency.Round(time.Microsecond))
+	default:
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("meta-data/instance-id returned status %d with a session token", resp.StatusCode)
+	}
+	return c
+}
+
+func (d *doctor) checkGetWithoutToken(ctx context.Context) Check {
+	c := Check{Name: CheckGetWithoutToken}
+	resp, _, _, err := d.do(ctx, http.MethodGet, d.opts.Endpoint, "/latest/meta-data/instance-id", "")
+	switch {
+	case err != nil:
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("no response: %v", err)
+		c.Hint = fmt.Sprintf("check that this runs on EC2 with the metadata service enabled and that nothing blocks %s", hostname(d.opts.Endpoint))
+	case resp.StatusCode == http.StatusOK:
+		c.Status = StatusWarn
+		c.Detail = "IMDSv1 is enabled, so metadata can be read without a session token"
+		c.Hint = "require IMDSv2 to protect against SSRF: aws ec2 modify-instance-metadata-options --instance-id <id> --http-tokens required"
+	case resp.StatusCode == http.StatusUnauthorized && d.token != "":
+		c.Status = StatusPass
+		c.Detail = "IMDSv1 is disabled (IMDSv2 required)"
+	case resp.StatusCode == http.StatusUnauthorized:
+		c.Status = StatusFail
+		c.Detail = "IMDSv1 is disabled and no session token could be obtained, so metadata cannot be read"
+		c.Hint = "fix the token check, or allow IMDSv1: aws ec2 modify-instance-metadata-options --instance-id <id> --http-tokens optional"
+	default:
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("meta-data/instance-id returned status %d", resp.StatusCode)
+	}
+	return c
+}
+
+// checkEndpoint checks that the default endpoint for one address family
+// answers. It is skipped for custom endpoints.
+func (d *doctor) checkEndpoint(ctx context.Context, name, endpoint string) Check {
+	c := Check{Name: name}
+	if d.opts.Endpoint != imds.DefaultEndpoint && d.opts.Endpoint != imds.DefaultIPv6Endpoint {
+		c.Status = StatusSkip
+		c.Detail = "custom endpoint"
+		return c
+	}
+	_, _, latency, err := d.do(ctx, http.MethodPut, endpoint, token.Path, "")
+	switch {
+	case err == nil:
+		c.Status = StatusPass
+		c.Detail = fmt.Sprintf("%s answered in %s", endpoint, latency.Round(time.Microsecond))
+	case name == CheckIPv6Endpoint:
+		c.Status = StatusWarn
+		c.Detail = fmt.Sprintf("%s did not answer: %v", endpoint, err)
+		c.Hint = "the IPv6 endpoint is only available on Nitro instances in IPv6 subnets once enabled: " +
+			"aws ec2 modify-instance-metadata-options --instance-id <id> --http-protocol-ipv6 enabled"
+	default:
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("%s did not answer: %v", endpoint, err)
+		c.Hint = "enable the metadata service: aws ec2 modify-instance-metadata-options --instance-id <id> --http-endpoint enabled"
+	}
+	return c
+}
+
+func (d *doctor) checkLatency(ctx context.Context) Check {
+	c := Check{Name: CheckLatency}
+	var latencies []time.Duration
+	for i := 0; i < latencySamples; i++ {
+		resp, _, latency, err := d.do(ctx, http.MethodGet, d.opts.Endpoint, "/latest/meta-data/instance-id", d.token)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			break
+		}
+		latencies = append(latencies, latency)
+	}
+	if len(latencies) == 0 {
+		c.Status = StatusSkip
+		c.Detail = "metadata cannot be read"
+		return c
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	avg := total / time.Duration(len(latencies))
+	c.Status = StatusPass
+	c.Detail = fmt.Sprintf("average %s, max %s over %d requests", avg.Round(time.Microsecond), latencies[len(latencies)-1].Round(time.Microsecond), len(latencies))
+	if avg > SlowLatency {
+		c.Status = StatusWarn
+		c.Hint = "IMDS normally answers within a few milliseconds; a proxy or overlay network may be in the way"
+	}
+	return c
+}
+
+func (d *doctor) checkTags(ctx context.Context, client *imds.Client) Check {
+	c := Check{Name: CheckTags}
+	names, err := client.List(ctx, "meta-data/tags/instance")
+	switch {
+	case errors.Is(err, imds.ErrNotFound):
+		c.Status = StatusWarn
+		c.Detail = "instance tags are not in metadata"
+		c.Hint = "allow tags in metadata: aws ec2 modify-instance-metadata-options --instance-id <id> --instance-metadata-tags enabled"
+	case err != nil:
+		c.Status = StatusSkip
+		c.Detail = unreadable(err)
+	default:
+		c.Status = StatusPass
+		c.Detail = fmt.Sprintf("%d tags readable", len(names))
+	}
+	return c
+}
+
+// unreadable describes why metadata could not be read for a skipped check.
+func unreadable(err error) string {
+	var imdsErr *imds.Error
+	if errors.As(err, &imdsErr) && imdsErr.Kind != nil {
+		return fmt.Sprintf("metadata cannot be read: %s", imdsErr.Kind)
+	}
+	return err.Error()
+}
+
+func (d *doctor) checkCredentials(ctx context.Context, client *imds.Client) Check {
+	c := Check{Name: CheckCredentials}
+	roles, err := client.List(ctx, "meta-data/iam/security-credentials")
+	switch {
+	case errors.Is(err, imds.ErrNotFound) || (err == nil && len(roles) == 0):
+		c.Status = StatusWarn
+		c.Detail = "no IAM instance profile attached"
+		c.Hint = "attach an instance profile if applications need AWS credentials: aws ec2 associate-iam-instance-profile"
+		return c
+	case err != nil:
+		c.Status = StatusSkip
+		c.Detail = unreadable(err)
+		return c
+	}
+	role := strings.TrimSuffix(roles[0], "/")
+	resp, err := client.Get(ctx, "meta-data/iam/security-credentials/"+role)
+	if err != nil {
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("credentials for %s cannot be read: %v", role, err)
+		return c
+	}
+	var doc struct{ Code, Message string }
+	if err := json.Unmarshal(resp, &doc); err != nil || doc.Code != "Success" {
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("credentials for %s are not available: %s %s", role, doc.Code, doc.Message)
+		c.Hint = "check that the instance profile's role exists and trusts ec2.amazonaws.com"
+		return c
+	}
+	c.Status = StatusPass
+	c.Detail = fmt.Sprintf("credentials for %s readable", role)
+	return c
+}
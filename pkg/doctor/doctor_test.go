@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		shape  mock.Shape
+		opts   mock.Options
+		env    map[string]string
+		want   map[string]Status
+		wantOK bool
+	}{
+		{
+			name:  "healthy",
+			shape: mock.Shape{IAMRole: "my-role", Tags: map[string]string{"Name": "web-1"}},
+			opts:  mock.Options{RequireToken: true},
+			env:   map[string]string{"HTTPS_PROXY": "http://proxy:3128", "NO_PROXY": "localhost,127.0.0.0/8"},
+			want: map[string]Status{
+				CheckProxy:           StatusPass,
+				CheckToken:           StatusPass,
+				CheckGetWithToken:    StatusPass,
+				CheckGetWithoutToken: StatusPass,
+				CheckIPv4Endpoint:    StatusSkip,
+				CheckIPv6Endpoint:    StatusSkip,
+				CheckLatency:         StatusPass,
+				CheckTags:            StatusPass,
+				CheckCredentials:     StatusPass,
+			},
+			wantOK: true,
+		},
+		{
+			name: "imdsv1 without tags or role behind a proxy",
+			env:  map[string]string{"HTTP_PROXY": "http://proxy:3128"},
+			want: map[string]Status{
+				CheckProxy:           StatusWarn,
+				CheckToken:           StatusPass,
+				CheckGetWithoutToken: StatusWarn,
+				CheckTags:            StatusWarn,
+				CheckCredentials:     StatusWarn,
+			},
+			wantOK: true,
+		},
+		{
+			name: "hop limit",
+			opts: mock.Options{RequireToken: true, Faults: &mock.Faults{Rules: []mock.Fault{{Path: "api/token", Drop: true}}}},
+			want: map[string]Status{
+				CheckToken:           StatusFail,
+				CheckGetWithToken:    StatusSkip,
+				CheckGetWithoutToken: StatusFail,
+				CheckLatency:         StatusSkip,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := mock.Generate(tt.shape)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			server := httptest.NewServer(mock.New(tree, tt.opts))
+			defer server.Close()
+
+			report := Run(context.Background(), Options{Endpoint: server.URL, Getenv: func(k string) string { return tt.env[k] }})
+			for name, want := range tt.want {
+				if c, ok := report.Check(name); !ok || c.Status != want {
+					t.Errorf("check %s = %+v, want %s", name, c, want)
+				}
+			}
+			if report.OK() != tt.wantOK {
+				t.Errorf("OK() = %v, want %v: %+v", report.OK(), tt.wantOK, report.Checks)
+			}
+			for _, c := range report.Checks {
+				if (c.Status == StatusFail || c.Status == StatusWarn) && c.Hint == "" && c.Name != CheckGetWithToken {
+					t.Errorf("check %s is %s without a hint", c.Name, c.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		noProxy, host string
+		want          bool
+	}{
+		{"169.254.169.254", "169.254.169.254", true},
+		{"localhost, 169.254.0.0/16", "169.254.169.254", true},
+		{"*", "169.254.169.254", true},
+		{"[fd00:ec2::254]", "fd00:ec2::254", true},
+		{"localhost,10.0.0.0/8", "169.254.169.254", false},
+		{"", "169.254.169.254", false},
+	}
+	for _, tt := range tests {
+		if got := excluded(tt.noProxy, tt.host); got != tt.want {
+			t.Errorf("excluded(%q, %q) = %v, want %v", tt.noProxy, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewall
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Decisions recorded in the audit log.
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+)
+
+// AuditEntry is written to the audit log as one JSON line per request.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Client    Client    `json:"client"`
+	Policy    string    `json:"policy"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Decision  string    `json:"decision"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latencyMs"`
+}
+
+type connKey struct{}
+
+// Firewall is an HTTP handler that applies per-client policies to IMDS
+// requests before passing allowed ones to the next handler, such as a proxy.Proxy.
+type Firewall struct {
+	cfg  *Config
+	next http.Handler
+
+	auditMu sync.Mutex
+	audit   *json.Encoder
+}
+
+// New creates a Firewall that writes its audit log to audit.
+func New(cfg *Config, next http.Handler, audit io.Writer) *Firewall {
+	return &Firewall{cfg: cfg, next: next, audit: json.NewEncoder(audit)}
+}
+
+// ConnContext records the connection on the request context so the peer UID
+// of Unix socket clients can be determined. Set it as http.Server.ConnContext.
+func (f *Firewall) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+func (f *Firewall) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	client := Client{Addr: r.RemoteAddr, UID: -1}
+	if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		client.UID = peerUID(c)
+	}
+	policy := f.cfg.PolicyFor(client)
+
+	// Clean the path so "meta-data/x/../iam/..." cannot bypass a deny rule,
+	// and forward the cleaned path so upstream sees what was checked.
+	cleaned := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	r.URL.Path = cleaned
+	r.URL.RawPath = ""
+	metadataPath := strings.Trim(strings.TrimPrefix(cleaned, "/latest"), "/")
+
+	decision := DecisionAllow
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	switch {
+	// Session tokens and listings of the API root carry no metadata.
+	case cleaned == "/latest/api/token" || metadataPath == "":
+		f.next.ServeHTTP(rec, r)
+	// Any other path must be below a category, so "meta-dataiam/..." cannot
+	// slip past rules written for "meta-data/iam/..." and be routed to it.
+	case !imds.IsMetadataPath(metadataPath):
+		decision = DecisionDeny
+		http.NotFound(rec, r)
+	case !policy.Allowed(metadataPath):
+		decision = DecisionDeny
+		http.Error(rec, "forbidden by policy "+policy.Name, http.StatusForbidden)
+	default:
+		f.next.ServeHTTP(rec, r)
+	}
+
+	f.auditMu.Lock()
+	defer f.auditMu.Unlock()
+	_ = f.audit.Encode(AuditEntry{
+		Time:      start.UTC(),
+		Client:    client,
+		Policy:    policy.Name,
+		Method:    r.Method,
+		Path:      cleaned,
+		Decision:  decision,
+		Status:    rec.status,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
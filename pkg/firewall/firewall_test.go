@@ -0,0 +1,191 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewall
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"meta-data/instance-id", "meta-data/instance-id", true},
+		{"meta-data/*", "meta-data/instance-id", true},
+		{"meta-data/*", "meta-data/placement/region", false},
+		{"meta-data/**", "meta-data/placement/region", true},
+		{"meta-data/**", "meta-data", true},
+		{"**/region", "meta-data/placement/region", true},
+		{"meta-data/iam/security-credentials/**", "meta-data/iam/security-credentials/role", true},
+		{"user-data", "user-data/", true},
+		{"dynamic/**", "meta-data/instance-id", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.glob, tt.path); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	cfg := &Config{
+		Default: Policy{Deny: []string{"user-data"}},
+		Policies: []Policy{
+			{Name: "trusted", UIDs: []int{0}, Allow: []string{"**"}},
+			{Name: "containers", CIDRs: []string{"172.17.0.0/16"}, Allow: []string{"meta-data/placement/**"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		client Client
+		path   string
+		want   bool
+	}{
+		{Client{Addr: "10.0.0.1:1234", UID: -1}, "meta-data/instance-id", true},
+		{Client{Addr: "10.0.0.1:1234", UID: -1}, "user-data", false},
+		{Client{Addr: "10.0.0.1:1234", UID: -1}, "meta-data/iam/security-credentials/role", false},
+		{Client{Addr: "10.0.0.1:1234", UID: -1}, "meta-data/iam/security-credentials", false},
+		{Client{UID: 0}, "meta-data/iam/security-credentials/role", true},
+		{Client{Addr: "172.17.0.5:1234", UID: -1}, "meta-data/placement/region", true},
+		{Client{Addr: "172.17.0.5:1234", UID: -1}, "meta-data/instance-id", false},
+	}
+	for _, tt := range tests {
+		policy := cfg.PolicyFor(tt.client)
+		if got := policy.Allowed(tt.path); got != tt.want {
+			t.Errorf("policy %q Allowed(%q) for %+v = %v, want %v", policy.Name, tt.path, tt.client, got, tt.want)
+		}
+	}
+}
+
+func newTestFirewall(t *testing.T, cfg *Config) (*Firewall, *bytes.Buffer) {
+	t.Helper()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+	audit := &bytes.Buffer{}
+	return New(cfg, next, audit), audit
+}
+
+func TestFirewallAudit(t *testing.T) {
+	fw, audit := newTestFirewall(t, &Config{})
+
+	for _, path := range []string{
+		"/latest/meta-data/instance-id",
+		"/latest/meta-data/placement/../iam/security-credentials/role",
+	} {
+		rec := httptest.NewRecorder()
+		fw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(audit)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decoding audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	if entries[0].Decision != DecisionAllow || entries[0].Status != http.StatusOK {
+		t.Errorf("first entry = %+v, want allowed", entries[0])
+	}
+	if entries[1].Decision != DecisionDeny || entries[1].Status != http.StatusForbidden ||
+		entries[1].Path != "/latest/meta-data/iam/security-credentials/role" {
+		t.Errorf("second entry = %+v, want cleaned credentials path denied", entries[1])
+	}
+}
+
+func TestFirewallUnknownCategory(t *testing.T) {
+	fw, audit := newTestFirewall(t, &Config{})
+
+	for _, path := range []string{
+		"/latest/meta-dataiam/security-credentials/role",
+		"/latest/dynamicinstance-identity/document",
+		"/latest/user-dataX",
+		"/2009-04-04/meta-data/iam/security-credentials/role",
+	} {
+		rec := httptest.NewRecorder()
+		fw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+		var e AuditEntry
+		if err := json.NewDecoder(audit).Decode(&e); err != nil {
+			t.Fatalf("decoding audit entry: %v", err)
+		}
+		if e.Decision != DecisionDeny {
+			t.Errorf("GET %s decision = %q, want %q", path, e.Decision, DecisionDeny)
+		}
+	}
+}
+
+func TestFirewallUnixPeerUID(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on Linux")
+	}
+	fw, audit := newTestFirewall(t, &Config{
+		Policies: []Policy{{Name: "me", UIDs: []int{os.Getuid()}, Allow: []string{"**"}}},
+	})
+	sock := filepath.Join(t.TempDir(), "imds.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	server := &http.Server{Handler: fw, ConnContext: fw.ConnContext}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { server.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://imds/latest/meta-data/iam/security-credentials/role")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 for trusted UID", resp.StatusCode)
+	}
+	var e AuditEntry
+	if err := json.Unmarshal(audit.Bytes(), &e); err != nil {
+		t.Fatalf("decoding audit entry: %v", err)
+	}
+	if e.Client.UID != os.Getuid() || e.Policy != "me" {
+		t.Errorf("audit entry = %+v, want uid %d and policy me", e, os.Getuid())
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bwagner5/imds/internal/glob"
+)
+
+// DefaultDeny are paths denied unless a policy explicitly allows them.
+var DefaultDeny = []string{
+	"meta-data/iam/security-credentials",
+	"meta-data/iam/security-credentials/**",
+	"meta-data/identity-credentials/**",
+}
+
+// Config is the policy file read by the firewall. Clients are matched against
+// Policies in order and fall back to Default.
+//
+//	default:
+//	  deny: ["user-data"]
+//	policies:
+//	  - name: trusted
+//	    uids: [0]
+//	    allow: ["**"]
+//	  - name: containers
+//	    cidrs: ["172.17.0.0/16"]
+//	    allow: ["meta-data/placement/**", "meta-data/instance-id"]
+type Config struct {
+	Default  Policy   `yaml:"default"`
+	Policies []Policy `yaml:"policies"`
+}
+
+// Policy decides which paths a set of clients may read. Deny globs win over
+// Allow globs. When Allow is empty every path not denied is allowed, except DefaultDeny.
+// Globs match path segments: "*" matches within one segment and "**" matches any number of them.
+type Policy struct {
+	Name  string   `yaml:"name"`
+	CIDRs []string `yaml:"cidrs"`
+	UIDs  []int    `yaml:"uids"`
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+
+	nets []*net.IPNet
+}
+
+// Client identifies who sent a request.
+type Client struct {
+	Addr string `json:"addr,omitempty"`
+	// UID is the peer UID for Unix socket connections, or -1.
+	UID int `json:"uid"`
+}
+
+// LoadConfig reads and validates a policy file.
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+// Validate parses CIDRs and checks globs.
+func (c *Config) Validate() error {
+	if c.Default.Name == "" {
+		c.Default.Name = "default"
+	}
+	if err := c.Default.validate(); err != nil {
+		return err
+	}
+	for i := range c.Policies {
+		p := &c.Policies[i]
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("policy-%d", i)
+		}
+		if len(p.CIDRs) == 0 && len(p.UIDs) == 0 {
+			return fmt.Errorf("policy %q: one of cidrs or uids is required", p.Name)
+		}
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Policy) validate() error {
+	p.nets = nil
+	for _, cidr := range p.CIDRs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		p.nets = append(p.nets, n)
+	}
+	for _, g := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if err := glob.Validate(g); err != nil {
+			return fmt.Errorf("policy %q: glob %q: %w", p.Name, g, err)
+		}
+	}
+	return nil
+}
+
+// PolicyFor returns the first policy matching the client, or the default policy.
+func (c *Config) PolicyFor(client Client) *Policy {
+	var ip net.IP
+	if host, _, err := net.SplitHostPort(client.Addr); err == nil {
+		ip = net.ParseIP(host)
+	}
+	for i := range c.Policies {
+		p := &c.Policies[i]
+		for _, uid := range p.UIDs {
+			if client.UID >= 0 && uid == client.UID {
+				return p
+			}
+		}
+		for _, n := range p.nets {
+			if ip != nil && n.Contains(ip) {
+				return p
+			}
+		}
+	}
+	return &c.Default
+}
+
+// Allowed reports whether the policy allows reading the cleaned metadata path,
+// e.g. "meta-data/instance-id".
+func (p *Policy) Allowed(metadataPath string) bool {
+	if matchAny(p.Deny, metadataPath) {
+		return false
+	}
+	if matchAny(p.Allow, metadataPath) {
+		return true
+	}
+	if matchAny(DefaultDeny, metadataPath) {
+		return false
+	}
+	return len(p.Allow) == 0
+}
+
+func matchAny(globs []string, p string) bool {
+	for _, g := range globs {
+		if Match(g, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the slash-separated path matches glob, where "**"
+// matches zero or more whole segments.
+func Match(g, p string) bool {
+	return glob.Match(g, p)
+}
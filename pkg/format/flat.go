@@ -0,0 +1,106 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package format
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Flat writes one path=value line per leaf, like sysctl -a, so the output
+// can be searched with grep. Lists of plain values are joined with commas,
+// and values that span lines are quoted.
+func Flat(w io.Writer, tree map[string]any) error {
+	bw := bufio.NewWriter(w)
+	leaves(imds.Normalize(tree), "", func(p, value string) {
+		fmt.Fprintf(bw, "%s=%s\n", p, quoteLine(value))
+	})
+	return bw.Flush()
+}
+
+// Table writes one line per leaf with the path and value in aligned columns,
+// formatting values as Flat does.
+func Table(w io.Writer, tree map[string]any) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	leaves(imds.Normalize(tree), "", func(p, value string) {
+		fmt.Fprintf(tw, "%s\t%s\n", p, quoteLine(value))
+	})
+	return tw.Flush()
+}
+
+// quoteLine quotes value if it spans lines or has surrounding space, so it
+// stays on one line.
+func quoteLine(value string) string {
+	if strings.ContainsAny(value, "\n\r") || value != strings.TrimSpace(value) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// Env writes one KEY=value line per leaf, named by EnvName and quoted for
+// POSIX shells, so the output can be evaluated.
+func Env(w io.Writer, tree map[string]any) error {
+	bw := bufio.NewWriter(w)
+	leaves(imds.Normalize(tree), "", func(p, value string) {
+		fmt.Fprintf(bw, "%s=%s\n", EnvName(p), ShellQuote(value))
+	})
+	return bw.Flush()
+}
+
+// leaves calls fn with the path and value of every leaf below v, in
+// imds.SortedKeys order. Lists of plain values are a single leaf; lists
+// holding maps or lists are indexed.
+func leaves(v any, p string, fn func(p, value string)) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range imds.SortedKeys(v) {
+			leaves(v[k], join(p, k), fn)
+		}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				for i, item := range v {
+					leaves(item, join(p, strconv.Itoa(i)), fn)
+				}
+				return
+			}
+			values = append(values, scalar(item))
+		}
+		fn(p, strings.Join(values, ","))
+	default:
+		fn(p, scalar(v))
+	}
+}
+
+// scalar formats a plain value as text, with null as the empty string.
+func scalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,158 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package format writes metadata trees, as returned by imds.Backend.GetAll,
+// in the CLI's output formats. Formats are looked up by name, and others can
+// be registered.
+package format
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Formatter writes a metadata tree.
+type Formatter interface {
+	Format(w io.Writer, tree map[string]any) error
+}
+
+// FormatterFunc adapts a function to a Formatter.
+type FormatterFunc func(w io.Writer, tree map[string]any) error
+
+// Format calls f.
+func (f FormatterFunc) Format(w io.Writer, tree map[string]any) error {
+	return f(w, tree)
+}
+
+var (
+	mu         sync.RWMutex
+	formatters = map[string]Formatter{
+		"json":  FormatterFunc(JSON),
+		"yaml":  FormatterFunc(YAML),
+		"toml":  FormatterFunc(TOML),
+		"flat":  FormatterFunc(Flat),
+		"env":   FormatterFunc(Env),
+		"table": FormatterFunc(Table),
+	}
+)
+
+// Register makes f available as name, replacing any formatter already
+// registered with that name.
+func Register(name string, f Formatter) {
+	mu.Lock()
+	defer mu.Unlock()
+	formatters[name] = f
+}
+
+// Lookup returns the formatter registered as name.
+func Lookup(name string) (Formatter, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if f, ok := formatters[name]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, must be one of %s", name, strings.Join(names(), ", "))
+}
+
+// Names returns the names of the registered formatters, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(formatters))
+	for name := range formatters {
+		list = append(list, name)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// JSON writes the tree as indented JSON.
+func JSON(w io.Writer, tree map[string]any) error {
+	data, err := imds.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// listKeys are the categories whose values are lists, even though IMDS
+// returns a single item as a plain value.
+var listKeys = map[string]bool{
+	"ancestor-ami-ids":        true,
+	"ipv4-prefix":             true,
+	"ipv6-prefix":             true,
+	"ipv6s":                   true,
+	"local-ipv4s":             true,
+	"product-codes":           true,
+	"public-ipv4s":            true,
+	"security-group-ids":      true,
+	"security-groups":         true,
+	"subnet-ipv6-cidr-blocks": true,
+	"vpc-ipv4-cidr-blocks":    true,
+	"vpc-ipv6-cidr-blocks":    true,
+}
+
+// typed returns the value at p with list typing restored for listKeys.
+func typed(p string, v any) any {
+	if s, ok := v.(string); ok && listKeys[path.Base(p)] && strings.HasPrefix(p, "meta-data/") {
+		if s == "" {
+			return []any{}
+		}
+		return []any{s}
+	}
+	return v
+}
+
+// join returns the child path of p named key.
+func join(p, key string) string {
+	if p == "" {
+		return key
+	}
+	return p + "/" + key
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// EnvName returns the environment variable name for a path or key, e.g.
+// INSTANCE_ID for instance-id and META_DATA_PLACEMENT_REGION for
+// meta-data/placement/region.
+func EnvName(p string) string {
+	name := strings.ToUpper(strings.Trim(nonIdentifier.ReplaceAllString(p, "_"), "_"))
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]*$`)
+
+// ShellQuote quotes s for POSIX shells if needed.
+func ShellQuote(s string) string {
+	if s != "" && shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
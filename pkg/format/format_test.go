@@ -0,0 +1,248 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package format
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+func testTree() map[string]any {
+	return map[string]any{
+		"meta-data": map[string]any{
+			"instance-id":     "i-1234567890abcdef0",
+			"security-groups": "default",
+			"placement":       map[string]any{"region": "us-east-1"},
+			"block-device-mapping": map[string]any{
+				"ebs10": "sdk",
+				"ebs2":  "sdc",
+			},
+			"network": map[string]any{"interfaces": map[string]any{"macs": map[string]any{
+				"0e:00:00:00:00:01": map[string]any{"local-ipv4s": []any{"10.0.0.1", "10.0.0.2"}},
+			}}},
+		},
+		"dynamic": map[string]any{"instance-identity": map[string]any{"document": map[string]any{
+			"region":          "us-east-1",
+			"billingProducts": nil,
+			"version":         "2017-09-30",
+			"launchIndex":     float64(0),
+		}}},
+		"user-data": "#!/bin/bash\necho 'hello'\n",
+	}
+}
+
+func TestFlat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Flat(&buf, testTree()); err != nil {
+		t.Fatal(err)
+	}
+	want := `dynamic/instance-identity/document/billingProducts=
+dynamic/instance-identity/document/launchIndex=0
+dynamic/instance-identity/document/region=us-east-1
+dynamic/instance-identity/document/version=2017-09-30
+meta-data/block-device-mapping/ebs2=sdc
+meta-data/block-device-mapping/ebs10=sdk
+meta-data/network/interfaces/macs/0e:00:00:00:00:01/local-ipv4s=10.0.0.1,10.0.0.2
+meta-data/placement/region=us-east-1
+meta-data/instance-id=i-1234567890abcdef0
+meta-data/security-groups=default
+user-data="#!/bin/bash\necho 'hello'\n"
+`
+	if buf.String() != want {
+		t.Errorf("Flat() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Env(&buf, map[string]any{"meta-data": map[string]any{
+		"placement":       map[string]any{"availability-zone": "us-east-1a"},
+		"security-groups": []any{"web", "it's"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	want := `META_DATA_PLACEMENT_AVAILABILITY_ZONE=us-east-1a
+META_DATA_SECURITY_GROUPS='web,it'\''s'
+`
+	if buf.String() != want {
+		t.Errorf("Env() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Table(&buf, map[string]any{
+		"instance-id":     "i-1234567890abcdef0",
+		"az":              "us-east-1a",
+		"security-groups": []any{"default", "web"},
+		"user-data":       "#!/bin/bash\n",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := `az               us-east-1a
+instance-id      i-1234567890abcdef0
+security-groups  default,web
+user-data        "#!/bin/bash\n"
+`
+	if buf.String() != want {
+		t.Errorf("Table() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := YAML(&buf, testTree()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Index(out, "ebs2:") > strings.Index(out, "ebs10:") || strings.Index(out, "placement:") > strings.Index(out, "instance-id:") {
+		t.Errorf("YAML() is not in tree order:\n%s", out)
+	}
+	var got map[string]any
+	if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("YAML() output does not parse: %v\n%s", err, out)
+	}
+	md := got["meta-data"].(map[string]any)
+	if !reflect.DeepEqual(md["security-groups"], []any{"default"}) {
+		t.Errorf("security-groups = %#v, want a list", md["security-groups"])
+	}
+	if got["user-data"] != "#!/bin/bash\necho 'hello'\n" {
+		t.Errorf("user-data = %q", got["user-data"])
+	}
+}
+
+func TestAnnotatedYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := AnnotatedYAML(&buf, testTree()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"    # The virtual devices associated with any Amazon EBS volumes.",
+		"    # Since: 2007-12-15\n    ebs2: sdc\n",
+		"# Since: 2011-01-01\n          local-ipv4s:\n",
+		"  # The ID of this instance.\n  # Since: 1.0\n  instance-id: i-1234567890abcdef0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("AnnotatedYAML() does not contain %q:\n%s", want, out)
+		}
+	}
+	var got, plain map[string]any
+	if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("AnnotatedYAML() output does not parse: %v\n%s", err, out)
+	}
+	buf.Reset()
+	if err := YAML(&buf, testTree()); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &plain); err != nil || !reflect.DeepEqual(got, plain) {
+		t.Errorf("AnnotatedYAML() values differ from YAML(): %v", err)
+	}
+	if strings.Contains(buf.String(), "# Since:") {
+		t.Errorf("YAML() has comments:\n%s", buf.String())
+	}
+}
+
+func TestTOML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := TOML(&buf, testTree()); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if _, err := toml.Decode(buf.String(), &got); err != nil {
+		t.Fatalf("TOML() output does not parse: %v\n%s", err, buf.String())
+	}
+	md := got["meta-data"].(map[string]any)
+	if !reflect.DeepEqual(md["security-groups"], []any{"default"}) {
+		t.Errorf("security-groups = %#v, want a list", md["security-groups"])
+	}
+	macs := md["network"].(map[string]any)["interfaces"].(map[string]any)["macs"].(map[string]any)
+	if ips := macs["0e:00:00:00:00:01"].(map[string]any)["local-ipv4s"]; !reflect.DeepEqual(ips, []any{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("local-ipv4s = %#v", ips)
+	}
+	doc := got["dynamic"].(map[string]any)["instance-identity"].(map[string]any)["document"].(map[string]any)
+	if _, ok := doc["billingProducts"]; ok || doc["launchIndex"] != int64(0) {
+		t.Errorf("document = %#v, want nulls dropped and numbers kept", doc)
+	}
+	if got["user-data"] != "#!/bin/bash\necho 'hello'\n" {
+		t.Errorf("user-data = %q", got["user-data"])
+	}
+}
+
+// TestClientLists formats a tree as imds.Client.GetAll returns it, with
+// newline-separated values as []string.
+func TestClientLists(t *testing.T) {
+	tree := map[string]any{"meta-data": map[string]any{
+		"security-groups": []string{"default", "web"},
+		"placement":       map[string]any{"region": "us-east-1"},
+	}}
+	tests := []struct {
+		name string
+		f    FormatterFunc
+		want string
+	}{
+		{"flat", Flat, "meta-data/placement/region=us-east-1\nmeta-data/security-groups=default,web\n"},
+		{"env", Env, "META_DATA_PLACEMENT_REGION=us-east-1\nMETA_DATA_SECURITY_GROUPS=default,web\n"},
+		{"yaml", YAML, "meta-data:\n  placement:\n    region: us-east-1\n  security-groups:\n    - default\n    - web\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.f(&buf, tree); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("%s =\n%s\nwant\n%s", tt.name, buf.String(), tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := TOML(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if _, err := toml.Decode(buf.String(), &got); err != nil {
+		t.Fatalf("decoding TOML: %v\n%s", err, buf.String())
+	}
+	md, _ := got["meta-data"].(map[string]any)
+	if want := []any{"default", "web"}; !reflect.DeepEqual(md["security-groups"], want) {
+		t.Errorf("TOML security-groups = %#v, want %#v", md["security-groups"], want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if _, err := Lookup("xml"); err == nil {
+		t.Error("Lookup(xml) succeeded")
+	}
+	Register("count", FormatterFunc(func(w io.Writer, tree map[string]any) error {
+		_, err := w.Write([]byte{byte('0' + len(tree))})
+		return err
+	}))
+	f, err := Lookup("count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, testTree()); err != nil || buf.String() != "3" {
+		t.Errorf("Format() = %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package format
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// TOML writes the tree as TOML, with each directory as a table in
+// imds.SortedKeys order and list-valued categories such as security-groups
+// as arrays even when they hold a single item. TOML has no null, so null
+// values in JSON documents are left out.
+func TOML(w io.Writer, tree map[string]any) error {
+	enc := &tomlEncoder{w: bufio.NewWriter(w)}
+	enc.table(imds.Normalize(tree), "", nil)
+	return enc.w.Flush()
+}
+
+type tomlEncoder struct {
+	w       *bufio.Writer
+	written bool
+}
+
+// table writes the values of table m at p, then its subtables under headers
+// named by keys.
+func (e *tomlEncoder) table(m map[string]any, p string, keys []string) {
+	var tables []string
+	for _, k := range imds.SortedKeys(m) {
+		switch v := typed(join(p, k), m[k]); v.(type) {
+		case nil:
+		case map[string]any:
+			tables = append(tables, k)
+		default:
+			fmt.Fprintf(e.w, "%s = %s\n", tomlKey(k), tomlValue(v))
+			e.written = true
+		}
+	}
+	for _, k := range tables {
+		sub := append(append([]string{}, keys...), tomlKey(k))
+		// Headers of tables holding only tables are implied by theirs.
+		if child := m[k].(map[string]any); len(child) == 0 || hasValues(child) {
+			if e.written {
+				e.w.WriteString("\n")
+			}
+			fmt.Fprintf(e.w, "[%s]\n", strings.Join(sub, "."))
+			e.written = true
+		}
+		e.table(m[k].(map[string]any), join(p, k), sub)
+	}
+}
+
+// hasValues reports whether m holds anything other than tables and nulls.
+func hasValues(m map[string]any) bool {
+	for _, v := range m {
+		switch v.(type) {
+		case nil, map[string]any:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if bareKey.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlValue formats v inline: maps as inline tables and lists as arrays.
+func tomlValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return tomlString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				items = append(items, tomlValue(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		fields := make([]string, 0, len(v))
+		for _, k := range imds.SortedKeys(v) {
+			if v[k] != nil {
+				fields = append(fields, tomlKey(k)+" = "+tomlValue(v[k]))
+			}
+		}
+		if len(fields) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	}
+	return tomlString(fmt.Sprint(v))
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,106 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package format
+
+import (
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bwagner5/imds/pkg/docs"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// YAML writes the tree as YAML in imds.SortedKeys order, with list-valued
+// categories such as security-groups as sequences even when they hold a
+// single item.
+func YAML(w io.Writer, tree map[string]any) error {
+	return encodeYAML(w, tree, false)
+}
+
+// AnnotatedYAML is YAML with a comment above each documented key giving its
+// description and the IMDS version it appeared in, from pkg/docs.
+func AnnotatedYAML(w io.Writer, tree map[string]any) error {
+	return encodeYAML(w, tree, true)
+}
+
+func encodeYAML(w io.Writer, tree map[string]any, annotate bool) error {
+	node, err := yamlNode(imds.Normalize(tree), "", annotate)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func yamlNode(v any, p string, annotate bool) (*yaml.Node, error) {
+	switch v := typed(p, v).(type) {
+	case map[string]any:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, k := range imds.SortedKeys(v) {
+			value, err := yamlNode(v[k], join(p, k), annotate)
+			if err != nil {
+				return nil, err
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
+			if entry, ok := docs.Lookup(join(p, k)); ok && annotate {
+				key.HeadComment = annotation(entry)
+			}
+			node.Content = append(node.Content, key, value)
+		}
+		return node, nil
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			value, err := yamlNode(item, "", false)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(v); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
+
+// annotationWidth is the width comments are wrapped to.
+const annotationWidth = 100
+
+func annotation(entry docs.Entry) string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(entry.Description) {
+		if line != "" && len(line)+1+len(word) > annotationWidth {
+			lines = append(lines, line)
+			line = ""
+		}
+		line = strings.TrimPrefix(line+" "+word, " ")
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	lines = append(lines, "Since: "+entry.Version)
+	return "# " + strings.Join(lines, "\n# ")
+}
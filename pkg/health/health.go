@@ -0,0 +1,144 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+const DefaultPollInterval = 5 * time.Second
+
+// DefaultLifecycleStates are the target lifecycle states that make the instance unhealthy.
+var DefaultLifecycleStates = []string{"Terminated", "Detached"}
+
+// Signals that can make the instance unhealthy.
+const (
+	SignalSpotInterruption = "spot-interruption"
+	SignalRebalance        = "rebalance-recommendation"
+	SignalLifecycleState   = "lifecycle-state"
+)
+
+// Options selects which signals make the instance unhealthy.
+type Options struct {
+	PollInterval time.Duration
+	// Spot reports unhealthy once a spot interruption is scheduled.
+	Spot bool
+	// Rebalance reports unhealthy once a rebalance recommendation is issued.
+	Rebalance bool
+	// LifecycleStates are the Auto Scaling target lifecycle states that report unhealthy.
+	LifecycleStates []string
+}
+
+// Reason explains why the instance is unhealthy.
+type Reason struct {
+	Signal   string     `json:"signal"`
+	Detail   string     `json:"detail,omitempty"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// Status is the health of the instance as served on /healthz.
+type Status struct {
+	Healthy bool      `json:"healthy"`
+	Reasons []Reason  `json:"reasons,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// Checker tracks whether the instance is being reclaimed.
+type Checker struct {
+	client *imds.Client
+	opts   Options
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// NewChecker creates a Checker. The instance is considered healthy until the first check.
+func NewChecker(client *imds.Client, opts Options) *Checker {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	return &Checker{client: client, opts: opts, status: Status{Healthy: true}}
+}
+
+// Check queries IMDS for the enabled signals and records the resulting status.
+func (c *Checker) Check(ctx context.Context) Status {
+	var reasons []Reason
+	if c.opts.Spot {
+		if action, err := c.client.SpotInstanceAction(ctx); err == nil {
+			deadline := action.Time
+			reasons = append(reasons, Reason{Signal: SignalSpotInterruption, Detail: action.Action, Deadline: &deadline})
+		}
+	}
+	if c.opts.Rebalance {
+		if rebalance, err := c.client.RebalanceRecommendation(ctx); err == nil {
+			reasons = append(reasons, Reason{Signal: SignalRebalance, Detail: "noticed at " + rebalance.NoticeTime.Format(time.RFC3339)})
+		}
+	}
+	if len(c.opts.LifecycleStates) > 0 {
+		if state, err := c.client.TargetLifecycleState(ctx); err == nil {
+			for _, s := range c.opts.LifecycleStates {
+				if s == state {
+					reasons = append(reasons, Reason{Signal: SignalLifecycleState, Detail: state})
+					break
+				}
+			}
+		}
+	}
+
+	status := Status{Healthy: len(reasons) == 0, Reasons: reasons, Checked: time.Now().UTC()}
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+	return status
+}
+
+// Run checks the signals every poll interval until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the most recent status.
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+// ServeHTTP responds 200 while healthy and 503 otherwise, with the status as JSON.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	status := c.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if status.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+func newTestChecker(t *testing.T, paths map[string]string, opts Options) *Checker {
+	t.Helper()
+	fake := mock.New(nil, mock.Options{})
+	for path, value := range paths {
+		fake.Set(path, value)
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := imds.NewClient(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	return NewChecker(client, opts)
+}
+
+func TestChecker(t *testing.T) {
+	spot := map[string]string{"meta-data/spot/instance-action": `{"action":"terminate","time":"2017-09-18T08:22:00Z"}`}
+	rebalance := map[string]string{"meta-data/events/recommendations/rebalance": `{"noticeTime":"2020-11-05T08:22:00Z"}`}
+	terminated := map[string]string{"meta-data/autoscaling/target-lifecycle-state": "Terminated"}
+	inService := map[string]string{"meta-data/autoscaling/target-lifecycle-state": "InService"}
+	defaults := Options{Spot: true, LifecycleStates: DefaultLifecycleStates}
+
+	tests := []struct {
+		name       string
+		paths      map[string]string
+		opts       Options
+		wantCode   int
+		wantSignal string
+	}{
+		{"healthy", inService, defaults, http.StatusOK, ""},
+		{"spot interruption", spot, defaults, http.StatusServiceUnavailable, SignalSpotInterruption},
+		{"spot disabled", spot, Options{LifecycleStates: DefaultLifecycleStates}, http.StatusOK, ""},
+		{"rebalance ignored by default", rebalance, defaults, http.StatusOK, ""},
+		{"rebalance enabled", rebalance, Options{Rebalance: true}, http.StatusServiceUnavailable, SignalRebalance},
+		{"terminated", terminated, defaults, http.StatusServiceUnavailable, SignalLifecycleState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := newTestChecker(t, tt.paths, tt.opts)
+			checker.Check(context.Background())
+
+			rec := httptest.NewRecorder()
+			checker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			var status Status
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if tt.wantSignal == "" {
+				if len(status.Reasons) != 0 {
+					t.Errorf("reasons = %+v, want none", status.Reasons)
+				}
+			} else if len(status.Reasons) != 1 || status.Reasons[0].Signal != tt.wantSignal {
+				t.Errorf("reasons = %+v, want %s", status.Reasons, tt.wantSignal)
+			}
+		})
+	}
+}
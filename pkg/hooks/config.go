@@ -0,0 +1,129 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultPollInterval   = 5 * time.Second
+	DefaultWebhookRetries = 3
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+// Config is the hooks file read by the daemon.
+//
+//	pollInterval: 5s
+//	stateFile: /var/lib/imds/hooks-state.json
+//	hooks:
+//	  - name: drain
+//	    on: [spot-interruption, rebalance-recommendation]
+//	    exec: ["/usr/local/bin/drain.sh"]
+//	  - name: notify
+//	    on: [maintenance-scheduled]
+//	    webhook:
+//	      url: https://hooks.example.com/imds
+type Config struct {
+	PollInterval time.Duration `yaml:"pollInterval"`
+	StateFile    string        `yaml:"stateFile"`
+	Hooks        []Hook        `yaml:"hooks"`
+}
+
+// Hook maps one or more event types to the actions run when they occur.
+type Hook struct {
+	Name    string   `yaml:"name"`
+	On      []string `yaml:"on"`
+	Exec    []string `yaml:"exec"`
+	Webhook *Webhook `yaml:"webhook"`
+}
+
+// Webhook POSTs the event as JSON to URL, retrying failed deliveries.
+type Webhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Retries *int              `yaml:"retries"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+// LoadConfig reads and validates a hooks file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the config and fills in defaults.
+func (c *Config) Validate() error {
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+	if len(c.Hooks) == 0 {
+		return errors.New("no hooks configured")
+	}
+	for i := range c.Hooks {
+		h := &c.Hooks[i]
+		if h.Name == "" {
+			h.Name = fmt.Sprintf("hook-%d", i)
+		}
+		if len(h.On) == 0 {
+			return fmt.Errorf("hook %q: no events in on", h.Name)
+		}
+		for _, t := range h.On {
+			if !isEventType(t) {
+				return fmt.Errorf("hook %q: unknown event %q", h.Name, t)
+			}
+		}
+		if len(h.Exec) == 0 && h.Webhook == nil {
+			return fmt.Errorf("hook %q: one of exec or webhook is required", h.Name)
+		}
+		if h.Webhook != nil {
+			if h.Webhook.URL == "" {
+				return fmt.Errorf("hook %q: webhook url is required", h.Name)
+			}
+			if h.Webhook.Retries == nil {
+				retries := DefaultWebhookRetries
+				h.Webhook.Retries = &retries
+			}
+			if h.Webhook.Timeout <= 0 {
+				h.Webhook.Timeout = DefaultWebhookTimeout
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Hook) handles(eventType string) bool {
+	for _, t := range h.On {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
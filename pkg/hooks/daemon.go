@@ -0,0 +1,173 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Daemon polls IMDS and runs the configured hooks when events appear.
+type Daemon struct {
+	client     *imds.Client
+	cfg        *Config
+	state      *State
+	httpClient *http.Client
+	logger     *log.Logger
+	// retryBackoff is the delay before the first webhook retry; it doubles each attempt.
+	retryBackoff time.Duration
+}
+
+// New creates a Daemon, loading persisted state from cfg.StateFile.
+func New(client *imds.Client, cfg *Config) (*Daemon, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	st, err := LoadState(cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Daemon{
+		client:       client,
+		cfg:          cfg,
+		state:        st,
+		httpClient:   &http.Client{},
+		logger:       log.New(os.Stderr, "imds: ", log.LstdFlags),
+		retryBackoff: time.Second,
+	}, nil
+}
+
+// SetLogger replaces the logger used to report fired events and action failures.
+func (d *Daemon) SetLogger(logger *log.Logger) {
+	d.logger = logger
+}
+
+// Run checks for events every poll interval until ctx is cancelled.
+func (d *Daemon) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.Check(ctx); err != nil {
+			d.logger.Printf("saving state: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check polls IMDS once, fires hooks for events that have not fired before and
+// persists the state. It returns the events that fired.
+func (d *Daemon) Check(ctx context.Context) ([]Event, error) {
+	now := time.Now()
+	var fired []Event
+	for _, e := range detect(ctx, d.client, d.state, now) {
+		if _, ok := d.state.Fired[e.ID]; ok {
+			continue
+		}
+		d.fire(ctx, e)
+		d.state.Fired[e.ID] = now
+		fired = append(fired, e)
+	}
+	return fired, d.state.Save(now)
+}
+
+func (d *Daemon) fire(ctx context.Context, e Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		d.logger.Printf("encoding event %s: %s", e.ID, err)
+		return
+	}
+	for _, h := range d.cfg.Hooks {
+		if !h.handles(e.Type) {
+			continue
+		}
+		d.logger.Printf("hook %q: firing for %s", h.Name, e.ID)
+		if len(h.Exec) > 0 {
+			if err := runExec(ctx, h.Exec, e, payload); err != nil {
+				d.logger.Printf("hook %q: exec: %s", h.Name, err)
+			}
+		}
+		if h.Webhook != nil {
+			if err := d.postWebhook(ctx, h.Webhook, payload); err != nil {
+				d.logger.Printf("hook %q: webhook: %s", h.Name, err)
+			}
+		}
+	}
+}
+
+func runExec(ctx context.Context, argv []string, e Event, payload []byte) error {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "IMDS_EVENT_ID="+e.ID, "IMDS_EVENT_TYPE="+e.Type)
+	return cmd.Run()
+}
+
+func (d *Daemon) postWebhook(ctx context.Context, wh *Webhook, payload []byte) error {
+	backoff := d.retryBackoff
+	var err error
+	for attempt := 0; attempt <= *wh.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = d.post(ctx, wh, payload); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", *wh.Retries+1, err)
+}
+
+func (d *Daemon) post(ctx context.Context, wh *Webhook, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, wh.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", wh.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+type receiver struct {
+	mu     sync.Mutex
+	events []Event
+	fail   int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.fail > 0 {
+		rc.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var e Event
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rc.events = append(rc.events, e)
+}
+
+func setup(t *testing.T, on ...string) (*mock.Server, *receiver, *Config, string) {
+	t.Helper()
+	fake := mock.New(nil, mock.Options{})
+	imdsServer := httptest.NewServer(fake)
+	t.Cleanup(imdsServer.Close)
+	rc := &receiver{}
+	webhookServer := httptest.NewServer(rc)
+	t.Cleanup(webhookServer.Close)
+
+	cfg := &Config{
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+		Hooks:     []Hook{{Name: "test", On: on, Webhook: &Webhook{URL: webhookServer.URL}}},
+	}
+	return fake, rc, cfg, imdsServer.URL
+}
+
+func newDaemon(t *testing.T, endpoint string, cfg *Config) *Daemon {
+	t.Helper()
+	client, err := imds.NewClient(context.Background(), endpoint)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	d, err := New(client, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	d.SetLogger(log.New(io.Discard, "", 0))
+	d.retryBackoff = time.Millisecond
+	return d
+}
+
+func TestCheckFiresOnceAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	fake, rc, cfg, endpoint := setup(t, EventSpotInterruption, EventMaintenanceScheduled)
+	fake.Set("meta-data/spot/instance-action", `{"action":"terminate","time":"2017-09-18T08:22:00Z"}`)
+	fake.Set("meta-data/events/maintenance/scheduled",
+		`[{"Code":"system-reboot","EventId":"instance-event-1","State":"active"},{"Code":"system-reboot","EventId":"instance-event-2","State":"canceled"}]`)
+
+	d := newDaemon(t, endpoint, cfg)
+	for i := 0; i < 2; i++ {
+		if _, err := d.Check(ctx); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+	restarted := newDaemon(t, endpoint, cfg)
+	if fired, err := restarted.Check(ctx); err != nil || len(fired) != 0 {
+		t.Fatalf("Check() after restart = %v, %v, want nothing fired", fired, err)
+	}
+
+	var ids []string
+	for _, e := range rc.events {
+		ids = append(ids, e.ID)
+	}
+	sort.Strings(ids)
+	want := []string{"maintenance-scheduled/instance-event-1", "spot-interruption/terminate/2017-09-18T08:22:00Z"}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("received %v, want %v", ids, want)
+	}
+}
+
+func TestCheckFiresOnTagChange(t *testing.T) {
+	ctx := context.Background()
+	fake, rc, cfg, endpoint := setup(t, EventTagsChanged)
+	fake.Set("meta-data/tags/instance/env", "staging")
+	d := newDaemon(t, endpoint, cfg)
+
+	if fired, _ := d.Check(ctx); len(fired) != 0 {
+		t.Fatalf("initial Check() fired %v, want nothing", fired)
+	}
+	fake.Set("meta-data/tags/instance/env", "prod")
+	if fired, _ := d.Check(ctx); len(fired) != 1 {
+		t.Fatalf("Check() after change fired %v, want one event", fired)
+	}
+	if len(rc.events) != 1 {
+		t.Fatalf("received %d events, want 1", len(rc.events))
+	}
+	data, _ := rc.events[0].Data.(map[string]any)
+	if data["env"] != "prod" {
+		t.Errorf("event data = %v, want env=prod", rc.events[0].Data)
+	}
+}
+
+func TestCheckKeepsTagsOnReadFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault mock.Fault
+	}{
+		{"throttled", mock.Fault{Path: "meta-data/tags/**", Status: http.StatusTooManyRequests}},
+		{"tags not enabled", mock.Fault{Path: "meta-data/tags/**", Status: http.StatusNotFound}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake, rc, cfg, endpoint := setup(t, EventTagsChanged)
+			fake.Set("meta-data/tags/instance/env", "prod")
+			d := newDaemon(t, endpoint, cfg)
+			if fired, _ := d.Check(ctx); len(fired) != 0 {
+				t.Fatalf("initial Check() fired %v, want nothing", fired)
+			}
+
+			fake.SetFaults(&mock.Faults{Rules: []mock.Fault{tt.fault}})
+			if fired, _ := d.Check(ctx); len(fired) != 0 {
+				t.Fatalf("Check() during failure fired %v, want nothing", fired)
+			}
+			fake.SetFaults(&mock.Faults{})
+			if fired, _ := d.Check(ctx); len(fired) != 0 {
+				t.Fatalf("Check() after recovery fired %v, want nothing", fired)
+			}
+			if len(rc.events) != 0 {
+				t.Errorf("received %v, want no events", rc.events)
+			}
+		})
+	}
+}
+
+func TestChangedObservedAt(t *testing.T) {
+	st, _ := LoadState("")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, ok := st.changed(EventLifecycleStateChanged, "InService", now); ok {
+		t.Fatal("changed() reported a change for the first value")
+	}
+	e, ok := st.changed(EventLifecycleStateChanged, "Terminated", now)
+	if !ok {
+		t.Fatal("changed() reported no change")
+	}
+	if !e.Observed.Equal(now) || !strings.HasSuffix(e.ID, fmt.Sprintf("/%d", now.UnixNano())) {
+		t.Errorf("changed() = %+v, want observed and identified at %v", e, now)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	ctx := context.Background()
+	fake, rc, cfg, endpoint := setup(t, EventRebalance)
+	rc.fail = 2
+	fake.Set("meta-data/events/recommendations/rebalance", `{"noticeTime":"2020-11-05T08:22:00Z"}`)
+
+	d := newDaemon(t, endpoint, cfg)
+	if _, err := d.Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(rc.events) != 1 {
+		t.Errorf("received %d events, want 1 after retries", len(rc.events))
+	}
+}
+
+func TestExecReceivesEvent(t *testing.T) {
+	ctx := context.Background()
+	fake, _, cfg, endpoint := setup(t, EventLifecycleStateChanged)
+	out := filepath.Join(t.TempDir(), "event.json")
+	cfg.Hooks[0].Webhook = nil
+	cfg.Hooks[0].Exec = []string{"sh", "-c", "cat > " + out}
+	fake.Set("meta-data/autoscaling/target-lifecycle-state", "InService")
+
+	d := newDaemon(t, endpoint, cfg)
+	_, _ = d.Check(ctx)
+	fake.Set("meta-data/autoscaling/target-lifecycle-state", "Terminated")
+	_, _ = d.Check(ctx)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading exec output: %v", err)
+	}
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("decoding exec stdin: %v", err)
+	}
+	if e.Data != "Terminated" || e.Previous != "InService" {
+		t.Errorf("exec event = %+v, want InService -> Terminated", e)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"valid", Config{Hooks: []Hook{{On: []string{EventSpotInterruption}, Exec: []string{"true"}}}}, false},
+		{"no hooks", Config{}, true},
+		{"unknown event", Config{Hooks: []Hook{{On: []string{"nope"}, Exec: []string{"true"}}}}, true},
+		{"no action", Config{Hooks: []Hook{{On: []string{EventSpotInterruption}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Event types that hooks can be registered for.
+const (
+	EventSpotInterruption      = "spot-interruption"
+	EventRebalance             = "rebalance-recommendation"
+	EventMaintenanceScheduled  = "maintenance-scheduled"
+	EventTagsChanged           = "tags-changed"
+	EventLifecycleStateChanged = "lifecycle-state-changed"
+)
+
+var eventTypes = []string{
+	EventSpotInterruption,
+	EventRebalance,
+	EventMaintenanceScheduled,
+	EventTagsChanged,
+	EventLifecycleStateChanged,
+}
+
+func isEventType(t string) bool {
+	for _, et := range eventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is passed to hook actions as JSON.
+type Event struct {
+	// ID identifies the event so that it fires only once.
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Path     string    `json:"path"`
+	Observed time.Time `json:"observed"`
+	Data     any       `json:"data"`
+	// Previous is the prior value for change events.
+	Previous any `json:"previous,omitempty"`
+}
+
+// detect returns the events currently visible in IMDS. Change events are
+// reported relative to the last values recorded in state, which is updated.
+func detect(ctx context.Context, client *imds.Client, st *State, now time.Time) []Event {
+	var events []Event
+
+	if action, err := client.SpotInstanceAction(ctx); err == nil {
+		events = append(events, Event{
+			ID:   EventSpotInterruption + "/" + action.Action + "/" + action.Time.Format(time.RFC3339),
+			Type: EventSpotInterruption, Path: imds.SpotInstanceActionPath, Observed: now, Data: action,
+		})
+	}
+
+	if rebalance, err := client.RebalanceRecommendation(ctx); err == nil {
+		events = append(events, Event{
+			ID:   EventRebalance + "/" + rebalance.NoticeTime.Format(time.RFC3339),
+			Type: EventRebalance, Path: imds.RebalancePath, Observed: now, Data: rebalance,
+		})
+	}
+
+	if resp, err := client.Get(ctx, imds.MaintenanceScheduledPath); err == nil {
+		var scheduled []map[string]any
+		if json.Unmarshal(resp, &scheduled) == nil {
+			for _, e := range scheduled {
+				id, _ := e["EventId"].(string)
+				state, _ := e["State"].(string)
+				if id == "" || state == "canceled" || state == "completed" {
+					continue
+				}
+				events = append(events, Event{
+					ID:   EventMaintenanceScheduled + "/" + id,
+					Type: EventMaintenanceScheduled, Path: imds.MaintenanceScheduledPath, Observed: now, Data: e,
+				})
+			}
+		}
+	}
+
+	// Tags are compared only when read in full, so a throttled request or
+	// tags not being enabled in IMDS keeps the previous tags.
+	if tags, ok := instanceTags(ctx, client); ok {
+		if e, ok := st.changed(EventTagsChanged, tags, now); ok {
+			e.Path = imds.InstanceTagsPath
+			events = append(events, e)
+		}
+	}
+
+	if state, err := client.TargetLifecycleState(ctx); err == nil {
+		if e, ok := st.changed(EventLifecycleStateChanged, state, now); ok {
+			e.Path = imds.TargetLifecycleStatePath
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// instanceTags reads the instance tags, reporting false unless the listing
+// and every tag could be read.
+func instanceTags(ctx context.Context, client *imds.Client) (map[string]any, bool) {
+	if _, err := client.Get(ctx, imds.InstanceTagsPath); err != nil {
+		return nil, false
+	}
+	data, err := client.Crawl(ctx, imds.InstanceTagsPath)
+	if err != nil {
+		return nil, false
+	}
+	// An instance without tags lists nothing.
+	tags, ok := lookup(data, imds.InstanceTagsPath).(map[string]any)
+	if !ok {
+		tags = map[string]any{}
+	}
+	return tags, true
+}
+
+// lookup walks a GetAll result down to path.
+func lookup(data map[string]any, path string) any {
+	var cur any = data
+	for _, t := range strings.Split(path, "/") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[t]
+	}
+	return cur
+}
+
+func hash(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
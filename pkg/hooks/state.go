@@ -0,0 +1,106 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// stateRetention is how long fired event IDs are remembered.
+const stateRetention = 90 * 24 * time.Hour
+
+// State records which events have fired and the last seen values used to
+// detect changes. It is persisted so events do not fire again after a restart.
+type State struct {
+	Fired map[string]time.Time  `json:"fired"`
+	Last  map[string]lastRecord `json:"last"`
+
+	path string
+}
+
+type lastRecord struct {
+	Hash  string `json:"hash"`
+	Value any    `json:"value"`
+}
+
+// LoadState reads the state file at path. A missing file yields empty state,
+// and an empty path yields state that is kept only in memory.
+func LoadState(path string) (*State, error) {
+	st := &State{Fired: map[string]time.Time{}, Last: map[string]lastRecord{}, path: path}
+	if path == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("parsing state %s: %w", path, err)
+	}
+	if st.Fired == nil {
+		st.Fired = map[string]time.Time{}
+	}
+	if st.Last == nil {
+		st.Last = map[string]lastRecord{}
+	}
+	return st, nil
+}
+
+// Save atomically writes the state file, dropping fired IDs past retention.
+func (s *State) Save(now time.Time) error {
+	for id, t := range s.Fired {
+		if now.Sub(t) > stateRetention {
+			delete(s.Fired, id)
+		}
+	}
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// changed records value as the latest for eventType and returns a change
+// event observed at now if a different value had been recorded before.
+func (s *State) changed(eventType string, value any, now time.Time) (Event, bool) {
+	h := hash(value)
+	prev, known := s.Last[eventType]
+	s.Last[eventType] = lastRecord{Hash: h, Value: value}
+	if !known || prev.Hash == h {
+		return Event{}, false
+	}
+	return Event{
+		ID:       fmt.Sprintf("%s/%s-%s/%d", eventType, prev.Hash, h, now.UnixNano()),
+		Type:     eventType,
+		Observed: now,
+		Data:     value,
+		Previous: prev.Value,
+	}, true
+}
@@ -0,0 +1,143 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WatchInterval is how often Watch polls for changes.
+const WatchInterval = 2 * time.Second
+
+// Backend is a source of instance metadata: live IMDS (Client), an in-memory
+// tree (Memory) or a snapshot file (snapshot.Snapshot).
+type Backend interface {
+	// Get returns the raw value at path, e.g. "meta-data/instance-id".
+	// Directories return their listing.
+	Get(ctx context.Context, path string) ([]byte, error)
+	// List returns the names in the directory at path, with a trailing "/"
+	// on subdirectories, in SortListing order.
+	List(ctx context.Context, path string) ([]string, error)
+	// GetAll returns the tree below path, nested from the root.
+	GetAll(ctx context.Context, path string) map[string]any
+	// Watch sends the tree below path whenever it changes until ctx is done.
+	Watch(ctx context.Context, path string) <-chan map[string]any
+}
+
+var (
+	_ Backend = (*Client)(nil)
+	_ Backend = (*Memory)(nil)
+)
+
+// List returns the names in the directory at path.
+func (c *Client) List(ctx context.Context, path string) ([]string, error) {
+	resp, err := c.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return splitListing(resp), nil
+}
+
+func splitListing(resp []byte) []string {
+	var names []string
+	for _, line := range strings.Split(strings.Trim(string(resp), "\n"), "\n") {
+		if line != "" {
+			names = append(names, line)
+		}
+	}
+	SortListing(names)
+	return names
+}
+
+// Watch monitors the specified path for changes and sends updates to the returned channel.
+func (c *Client) Watch(ctx context.Context, path string) <-chan map[string]any {
+	return Poll(ctx, c, path, WatchInterval)
+}
+
+// Poll implements Watch for any backend by calling GetAll every interval and
+// sending the tree when it differs from the last one sent. Slow receivers
+// only see the latest tree.
+func Poll(ctx context.Context, b Backend, path string, interval time.Duration) <-chan map[string]any {
+	ch := make(chan map[string]any, 10)
+	go func() {
+		defer close(ch)
+		var prev map[string]any
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		check := func() {
+			data := b.GetAll(ctx, path)
+			if !reflect.DeepEqual(prev, data) {
+				select {
+				case ch <- data:
+				default:
+					<-ch
+					ch <- data
+				}
+				prev = data
+			}
+		}
+
+		check() // Initial check
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+	return ch
+}
+
+// FindKey searches a backend for a key name and returns its full path.
+func FindKey(ctx context.Context, b Backend, key string) string {
+	if paths := FindKeys(ctx, b, key); len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// FindKeys searches a backend for a key name and returns the full paths of
+// the deepest matches, in meta-data or else dynamic, sorted. More than one
+// path means the key is ambiguous.
+func FindKeys(ctx context.Context, b Backend, key string) []string {
+	for _, base := range []string{"meta-data", "dynamic"} {
+		data := b.GetAll(ctx, base)
+		if baseData, ok := data[base].(map[string]any); ok {
+			if paths := findKeyIn(baseData, "", key); len(paths) > 0 {
+				for i := range paths {
+					paths[i] = base + "/" + paths[i]
+				}
+				slices.SortFunc(paths, CompareKeys)
+				return paths
+			}
+		}
+	}
+	return nil
+}
+
+// AllKeys returns all leaf key names in a backend.
+func AllKeys(ctx context.Context, b Backend) []string {
+	data := b.GetAll(ctx, "")
+	var keys []string
+	collectKeys(data, &keys)
+	return keys
+}
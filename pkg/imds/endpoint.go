@@ -0,0 +1,156 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+// DefaultIPv6Endpoint is the IMDS endpoint on IPv6-enabled instances.
+const DefaultIPv6Endpoint = "http://[fd00:ec2::254]"
+
+// EndpointMode selects whether the client reaches IMDS over IPv4 or IPv6.
+type EndpointMode string
+
+const (
+	// EndpointModeAuto uses the address family of the endpoint, or IPv4 for
+	// the default endpoint.
+	EndpointModeAuto EndpointMode = ""
+	EndpointModeIPv4 EndpointMode = "ipv4"
+	// EndpointModeIPv6 uses DefaultIPv6Endpoint in place of the default
+	// endpoint, falling back to IPv4 if it is unreachable.
+	EndpointModeIPv6 EndpointMode = "ipv6"
+)
+
+// ParseEndpointMode parses "auto", "ipv4" or "ipv6", in any case.
+func ParseEndpointMode(s string) (EndpointMode, error) {
+	switch mode := EndpointMode(strings.ToLower(s)); mode {
+	case "auto":
+		return EndpointModeAuto, nil
+	case EndpointModeAuto, EndpointModeIPv4, EndpointModeIPv6:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid endpoint mode %q, want auto, ipv4 or ipv6", s)
+}
+
+// WithEndpointMode selects IPv4 or IPv6 instead of detecting it from the endpoint.
+func WithEndpointMode(mode EndpointMode) Option {
+	return func(o *clientOptions) {
+		o.endpointMode = mode
+	}
+}
+
+// DetectEndpointMode returns the address family of the host in endpoint, a
+// URL such as http://169.254.169.254 or http://[fd00:ec2::254]:80. Hostnames
+// are assumed to resolve to IPv4.
+func DetectEndpointMode(endpoint string) EndpointMode {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return EndpointModeIPv4
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && ip.To4() == nil {
+		return EndpointModeIPv6
+	}
+	return EndpointModeIPv4
+}
+
+// resolveEndpoint returns the endpoint and mode to use, and the endpoint to
+// fall back to if it is unreachable.
+func resolveEndpoint(endpoint string, mode EndpointMode) (string, EndpointMode, string) {
+	isDefault := endpoint == "" || endpoint == DefaultEndpoint
+	switch {
+	case mode == EndpointModeIPv6 && isDefault:
+		return DefaultIPv6Endpoint, mode, DefaultEndpoint
+	case isDefault:
+		return DefaultEndpoint, EndpointModeIPv4, ""
+	case mode == EndpointModeAuto:
+		return endpoint, DetectEndpointMode(endpoint), ""
+	}
+	return endpoint, mode, ""
+}
+
+func (m EndpointMode) sdkState() imds.EndpointModeState {
+	if m == EndpointModeIPv6 {
+		return imds.EndpointModeStateIPv6
+	}
+	return imds.EndpointModeStateIPv4
+}
+
+// fallbackTransport sends requests to fallback instead once the endpoint
+// cannot be connected to, and keeps doing so. Until the endpoint has answered,
+// requests go through first, which gives up on an unreachable endpoint sooner.
+type fallbackTransport struct {
+	first     http.RoundTripper
+	next      http.RoundTripper
+	fallback  *url.URL
+	connected atomic.Bool
+	fellBack  atomic.Bool
+}
+
+func newFallbackTransport(next http.RoundTripper, fallback string) (*fallbackTransport, error) {
+	u, err := url.Parse(fallback)
+	if err != nil {
+		return nil, fmt.Errorf("parsing fallback endpoint: %w", err)
+	}
+	if next != nil {
+		return &fallbackTransport{first: next, next: next, fallback: u}, nil
+	}
+	// Only the first attempt has short timeouts, so a slow but reachable
+	// endpoint is not abandoned later on.
+	first := awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) { d.Timeout = 250 * time.Millisecond }).
+		WithTransportOptions(func(tr *http.Transport) { tr.ResponseHeaderTimeout = 500 * time.Millisecond }).
+		GetTransport()
+	return &fallbackTransport{first: first, next: awshttp.NewBuildableClient().GetTransport(), fallback: u}, nil
+}
+
+func (t *fallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.fellBack.Load() {
+		rt := t.next
+		if !t.connected.Load() {
+			rt = t.first
+		}
+		resp, err := rt.RoundTrip(req)
+		var opErr *net.OpError
+		if err == nil || !errors.As(err, &opErr) || opErr.Op != "dial" {
+			t.connected.Store(true)
+			return resp, err
+		}
+		t.fellBack.Store(true)
+	}
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	req.URL.Scheme, req.URL.Host, req.Host = t.fallback.Scheme, t.fallback.Host, ""
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,129 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDetectEndpointMode(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     EndpointMode
+	}{
+		{"http://169.254.169.254", EndpointModeIPv4},
+		{"http://169.254.169.254:80/", EndpointModeIPv4},
+		{"http://[fd00:ec2::254]", EndpointModeIPv6},
+		{"http://[fd00:ec2::254]:8080", EndpointModeIPv6},
+		{"[::1]:1338", EndpointModeIPv6},
+		{"127.0.0.1:1338", EndpointModeIPv4},
+		{"http://localhost:1338", EndpointModeIPv4},
+		{"https://imds.example.com", EndpointModeIPv4},
+	}
+	for _, tt := range tests {
+		if got := DetectEndpointMode(tt.endpoint); got != tt.want {
+			t.Errorf("DetectEndpointMode(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint, wantEndpoint string
+		mode, wantMode         EndpointMode
+		wantFallback           string
+	}{
+		{"", DefaultEndpoint, EndpointModeAuto, EndpointModeIPv4, ""},
+		{DefaultEndpoint, DefaultEndpoint, EndpointModeIPv4, EndpointModeIPv4, ""},
+		{"", DefaultIPv6Endpoint, EndpointModeIPv6, EndpointModeIPv6, DefaultEndpoint},
+		{DefaultEndpoint, DefaultIPv6Endpoint, EndpointModeIPv6, EndpointModeIPv6, DefaultEndpoint},
+		{"http://[fd00:ec2::254]", "http://[fd00:ec2::254]", EndpointModeAuto, EndpointModeIPv6, ""},
+		{"http://localhost:1338", "http://localhost:1338", EndpointModeIPv6, EndpointModeIPv6, ""},
+	}
+	for _, tt := range tests {
+		endpoint, mode, fallback := resolveEndpoint(tt.endpoint, tt.mode)
+		if endpoint != tt.wantEndpoint || mode != tt.wantMode || fallback != tt.wantFallback {
+			t.Errorf("resolveEndpoint(%q, %q) = %q, %q, %q, want %q, %q, %q", tt.endpoint, tt.mode, endpoint, mode, fallback, tt.wantEndpoint, tt.wantMode, tt.wantFallback)
+		}
+	}
+	if _, err := ParseEndpointMode("ipv5"); err == nil {
+		t.Error("ParseEndpointMode(ipv5) succeeded")
+	}
+	if mode, err := ParseEndpointMode("IPv6"); err != nil || mode != EndpointModeIPv6 {
+		t.Errorf("ParseEndpointMode(IPv6) = %q, %v", mode, err)
+	}
+}
+
+func TestFallbackTransport(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write([]byte("i-1234567890abcdef0"))
+	}))
+	defer server.Close()
+
+	rt, err := newFallbackTransport(nil, server.URL)
+	if err != nil {
+		t.Fatalf("newFallbackTransport() error = %v", err)
+	}
+	// Nothing listens on port 1, so the connection is refused.
+	client, err := NewClient(context.Background(), "http://[::1]:1", WithoutSharedConfig(), WithTransport(rt))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if resp, err := client.Get(context.Background(), "meta-data/instance-id"); err != nil || string(resp) != "i-1234567890abcdef0" {
+			t.Fatalf("Get() = %q, %v, want the fallback's response", resp, err)
+		}
+	}
+	if !rt.fellBack.Load() {
+		t.Error("transport did not record the fallback")
+	}
+	if hits != 4 {
+		t.Errorf("fallback got %d requests, want 2 token requests and 2 GETs", hits)
+	}
+}
+
+func TestFallbackTransportSlowResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			issueToken(w)
+			return
+		}
+		// Slower than the first attempt's timeouts, but well within the SDK's.
+		time.Sleep(700 * time.Millisecond)
+		_, _ = w.Write([]byte("i-1234567890abcdef0"))
+	}))
+	defer server.Close()
+
+	rt, err := newFallbackTransport(nil, "http://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("newFallbackTransport() error = %v", err)
+	}
+	client, err := NewClient(context.Background(), server.URL, WithoutSharedConfig(), WithTransport(rt), WithMaxAttempts(1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if resp, err := client.Get(context.Background(), "meta-data/instance-id"); err != nil || string(resp) != "i-1234567890abcdef0" {
+		t.Fatalf("Get() = %q, %v, want the endpoint's response", resp, err)
+	}
+	if rt.fellBack.Load() {
+		t.Error("transport fell back from a reachable endpoint")
+	}
+}
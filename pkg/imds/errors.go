@@ -0,0 +1,153 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/bwagner5/imds/internal/token"
+)
+
+// Kinds of IMDS failures, for use with errors.Is. Errors returned by Client
+// and the other backends are *Error values wrapping one of them.
+var (
+	// ErrNotFound means the path does not exist (404).
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized means IMDS refused the request (401 or 403), e.g.
+	// because the session token expired or was rejected.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrThrottled means IMDS is rate limiting requests (429).
+	ErrThrottled = errors.New("throttled")
+	// ErrUnreachable means no response was received, e.g. off EC2 or when
+	// IMDS is disabled.
+	ErrUnreachable = errors.New("unreachable")
+	// ErrTokenUnavailable means IMDSv2 is required but no session token could
+	// be obtained, typically because the token PUT's response hop limit is too
+	// low for a container.
+	ErrTokenUnavailable = errors.New("session token unavailable")
+)
+
+// Error is a failed request for Path.
+type Error struct {
+	Path string
+	// Status is the HTTP status code, or zero if no response was received.
+	Status int
+	// Kind is one of ErrNotFound, ErrUnauthorized, ErrThrottled,
+	// ErrUnreachable or ErrTokenUnavailable, or nil if none applies.
+	Kind error
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// NewError returns the error for a request for path that failed with
+// status, or zero if there was no response, caused by err.
+func NewError(path string, status int, err error) *Error {
+	e := &Error{Path: path, Status: status, Err: err}
+	switch status {
+	case 0:
+		if !errors.Is(err, context.Canceled) {
+			e.Kind = ErrUnreachable
+		}
+	case http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		e.Kind = ErrUnauthorized
+	case http.StatusTooManyRequests:
+		e.Kind = ErrThrottled
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	msg := e.Path + ": "
+	switch {
+	case e.Kind != nil:
+		msg += e.Kind.Error()
+	default:
+		msg += "request failed"
+	}
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.Status)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	var errs []error
+	for _, err := range []error{e.Kind, e.Err} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// tokenFailures tracks whether the last session token request failed, since
+// the SDK then falls back to IMDSv1 and only the following 401 is returned.
+type tokenFailures struct {
+	failed atomic.Bool
+}
+
+// middleware records token failures and attaches the response status to
+// errors, which the SDK loses for 401s.
+func (t *tokenFailures) middleware(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("IMDSErrors", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleDeserialize(ctx, in)
+		if req, ok := in.Request.(*smithyhttp.Request); ok && req.Method == http.MethodPut && strings.HasSuffix(req.URL.Path, token.Path) {
+			t.failed.Store(err != nil)
+		}
+		if resp, ok := out.RawResponse.(*smithyhttp.Response); ok && err != nil {
+			err = &statusError{status: resp.StatusCode, err: err}
+		}
+		return out, metadata, err
+	}), middleware.Before)
+}
+
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string       { return e.err.Error() }
+func (e *statusError) Unwrap() error       { return e.err }
+func (e *statusError) HTTPStatusCode() int { return e.status }
+
+// wrapError classifies an error returned by the SDK for path.
+func (c *Client) wrapError(path string, err error) error {
+	status := 0
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		status = statusErr.HTTPStatusCode()
+	}
+	e := NewError(path, status, err)
+	switch {
+	case status == 0 && strings.Contains(err.Error(), "failed to get API token"):
+		e.Kind = ErrTokenUnavailable
+	case status == http.StatusUnauthorized && c.tokens != nil && c.tokens.failed.Load():
+		e.Kind = ErrTokenUnavailable
+	}
+	return e
+}
@@ -0,0 +1,180 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantKind error
+		status   int
+	}{
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					issueToken(w)
+					return
+				}
+				http.NotFound(w, r)
+			},
+			wantKind: ErrNotFound,
+			status:   http.StatusNotFound,
+		},
+		{
+			name: "token rejected",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					issueToken(w)
+					return
+				}
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantKind: ErrUnauthorized,
+			status:   http.StatusUnauthorized,
+		},
+		{
+			name: "throttled",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					issueToken(w)
+					return
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			wantKind: ErrThrottled,
+			status:   http.StatusTooManyRequests,
+		},
+		{
+			// The token PUT never gets a response, as when the hop limit is
+			// too low, and IMDSv1 is disabled.
+			name: "token unavailable",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					panic(http.ErrAbortHandler)
+				}
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantKind: ErrTokenUnavailable,
+			status:   http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			client, err := NewClient(ctx, server.URL, WithoutSharedConfig(), WithMaxAttempts(1))
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			_, err = client.Get(ctx, "meta-data/instance-id")
+			var imdsErr *Error
+			if !errors.As(err, &imdsErr) {
+				t.Fatalf("Get() error = %v, want *Error", err)
+			}
+			if !errors.Is(err, tt.wantKind) || imdsErr.Status != tt.status || imdsErr.Path != "meta-data/instance-id" {
+				t.Errorf("Get() error = %v (kind %v, status %d), want kind %v, status %d", err, imdsErr.Kind, imdsErr.Status, tt.wantKind, tt.status)
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client, err := NewClient(ctx, server.URL, WithoutSharedConfig(), WithMaxAttempts(1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := client.Get(ctx, "meta-data/instance-id"); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Get() from a closed server error = %v, want ErrUnreachable", err)
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/latest/api/token":
+			issueToken(w)
+		case "/latest/meta-data":
+			_, _ = w.Write([]byte("instance-id\nplacement/"))
+		case "/latest/meta-data/placement":
+			_, _ = w.Write([]byte("region"))
+		case "/latest/meta-data/instance-id":
+			_, _ = w.Write([]byte("i-1234567890abcdef0"))
+		case "/latest/meta-data/placement/region":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client, err := NewClient(ctx, server.URL, WithoutSharedConfig(), WithMaxAttempts(1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	data, err := client.Crawl(ctx, "meta-data")
+	if got := data["meta-data"].(map[string]any)["instance-id"]; got != "i-1234567890abcdef0" {
+		t.Errorf("Crawl() instance-id = %v", got)
+	}
+	var imdsErr *Error
+	if !errors.As(err, &imdsErr) || !errors.Is(err, ErrUnauthorized) || imdsErr.Path != "meta-data/placement/region" {
+		t.Errorf("Crawl() error = %v, want ErrUnauthorized for meta-data/placement/region", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("Crawl() error = %v, want missing paths to be skipped", err)
+	}
+}
+
+func issueToken(w http.ResponseWriter) {
+	w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	_, _ = w.Write([]byte("token"))
+}
+
+func TestGetUnknownCategory(t *testing.T) {
+	ctx := context.Background()
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			issueToken(w)
+			return
+		}
+		requests = append(requests, r.URL.Path)
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+	client, err := NewClient(ctx, server.URL, WithoutSharedConfig(), WithMaxAttempts(1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	for _, path := range []string{"meta-dataiam/security-credentials/role", "dynamicinstance-identity/document", "user-dataX"} {
+		if _, err := client.Get(ctx, path); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", path, err)
+		}
+	}
+	if len(requests) != 0 {
+		t.Errorf("requests = %v, want none", requests)
+	}
+}
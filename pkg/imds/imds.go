@@ -17,12 +17,11 @@ package imds
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net"
-	"reflect"
+	"net/http"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
@@ -33,30 +32,56 @@ const DefaultEndpoint = "http://169.254.169.254"
 // Client wraps the AWS IMDS client with additional functionality.
 type Client struct {
 	*imds.Client
+	endpoint string
+	tokens   *tokenFailures
+	// http sends requests made outside the SDK, such as probes.
+	http *http.Client
 }
 
-// NewClient creates a new IMDS client with the specified endpoint.
-func NewClient(ctx context.Context, endpoint string) (*Client, error) {
-	if endpoint == "" {
-		endpoint = DefaultEndpoint
+// NewClient creates a new IMDS client with the specified endpoint, or the
+// default endpoint for the endpoint mode if it is empty.
+func NewClient(ctx context.Context, endpoint string, opts ...Option) (*Client, error) {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		opt(o)
 	}
-	cfg, err := config.LoadDefaultConfig(ctx, withIMDSEndpoint(endpoint))
-	if err != nil {
+	if err := o.validate(); err != nil {
 		return nil, err
 	}
-	return &Client{Client: imds.NewFromConfig(cfg)}, nil
-}
-
-func withIMDSEndpoint(endpoint string) func(*config.LoadOptions) error {
-	return func(lo *config.LoadOptions) error {
-		lo.EC2IMDSEndpoint = endpoint
-		if net.ParseIP(endpoint).To4() == nil {
-			lo.EC2IMDSEndpointMode = imds.EndpointModeStateIPv6
-		} else {
-			lo.EC2IMDSEndpointMode = imds.EndpointModeStateIPv4
+	endpoint, mode, fallback := resolveEndpoint(endpoint, o.endpointMode)
+	if fallback != "" {
+		next := o.transport
+		if next == nil && o.httpClient != nil {
+			next = o.httpClient.Transport
+			if next == nil {
+				next = http.DefaultTransport
+			}
 		}
+		rt, err := newFallbackTransport(next, fallback)
+		if err != nil {
+			return nil, err
+		}
+		o.transport = rt
+	}
+	tokens := &tokenFailures{}
+	o.apiOptions = append(o.apiOptions, tokens.middleware)
+	if o.noSharedConfig {
+		return &Client{Client: imds.New(imds.Options{Endpoint: endpoint, EndpointMode: mode.sdkState()}, o.apply), endpoint: endpoint, tokens: tokens, http: o.client()}, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, func(lo *config.LoadOptions) error {
+		lo.EC2IMDSEndpoint = endpoint
+		lo.EC2IMDSEndpointMode = mode.sdkState()
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &Client{Client: imds.NewFromConfig(cfg, o.apply), endpoint: endpoint, tokens: tokens, http: o.client()}, nil
+}
+
+// Endpoint returns the endpoint the client sends requests to.
+func (c *Client) Endpoint() string {
+	return c.endpoint
 }
 
 // Get retrieves raw data from the specified IMDS path.
@@ -66,38 +91,45 @@ func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
 		return []byte("meta-data/\ndynamic/\nuser-data"), nil
 	}
 
-	switch {
-	case strings.HasPrefix(path, "dynamic"):
-		subPath := strings.TrimPrefix(strings.TrimPrefix(path, "dynamic"), "/")
+	category, subPath, _ := strings.Cut(path, "/")
+	switch category {
+	case "dynamic":
 		resp, err := c.Client.GetDynamicData(ctx, &imds.GetDynamicDataInput{Path: subPath})
 		if err != nil {
-			return nil, err
+			return nil, c.wrapError(path, err)
 		}
 		return io.ReadAll(resp.Content)
-	case strings.HasPrefix(path, "meta-data"):
-		subPath := strings.TrimPrefix(strings.TrimPrefix(path, "meta-data"), "/")
+	case "meta-data":
 		resp, err := c.Client.GetMetadata(ctx, &imds.GetMetadataInput{Path: subPath})
 		if err != nil {
-			return nil, err
+			return nil, c.wrapError(path, err)
 		}
 		return io.ReadAll(resp.Content)
-	case strings.HasPrefix(path, "user-data"):
+	case "user-data":
 		resp, err := c.Client.GetUserData(ctx, &imds.GetUserDataInput{})
 		if err != nil {
-			return nil, err
+			return nil, c.wrapError(path, err)
 		}
 		return io.ReadAll(resp.Content)
 	default:
-		return nil, fmt.Errorf("unsupported path: %s", path)
+		return nil, NewError(path, http.StatusNotFound, fmt.Errorf("unsupported path"))
 	}
 }
 
 // GetAll recursively retrieves all IMDS data from the specified path.
 // If path is empty, retrieves all data from all categories.
 func (c *Client) GetAll(ctx context.Context, path string) map[string]any {
+	result, _ := c.Crawl(ctx, path)
+	return result
+}
+
+// Crawl is GetAll, also returning the failures other than ErrNotFound that
+// left parts of the tree missing, joined, or nil if the tree is complete.
+func (c *Client) Crawl(ctx context.Context, path string) (map[string]any, error) {
 	path = strings.Trim(path, "/")
 	result := map[string]any{}
 	errs := map[string]bool{}
+	var failures []error
 
 	type item struct {
 		path     string
@@ -117,6 +149,9 @@ func (c *Client) GetAll(ctx context.Context, path string) map[string]any {
 
 		resp, err := c.Get(ctx, cur.path)
 		if err != nil {
+			if !errs[cur.path] && !errors.Is(err, ErrNotFound) {
+				failures = append(failures, err)
+			}
 			if !errs[cur.path] {
 				// Retry parent as terminal
 				tokens := strings.Split(cur.path, "/")
@@ -138,7 +173,7 @@ func (c *Client) GetAll(ctx context.Context, path string) map[string]any {
 		}
 
 		if cur.terminal {
-			c.setValueAt(result, cur.path, resp)
+			SetValueAt(result, cur.path, resp)
 		} else {
 			respStr := string(resp)
 			for _, line := range strings.Split(strings.Trim(respStr, "\n"), "\n") {
@@ -154,10 +189,12 @@ func (c *Client) GetAll(ctx context.Context, path string) map[string]any {
 			}
 		}
 	}
-	return result
+	return result, errors.Join(failures...)
 }
 
-func (c *Client) setValueAt(root map[string]any, path string, resp []byte) {
+// SetValueAt stores the IMDS response for path in a tree shaped like GetAll's
+// result, parsing JSON documents and splitting newline-separated values.
+func SetValueAt(root map[string]any, path string, resp []byte) {
 	tokens := strings.Split(path, "/")
 	key := tokens[len(tokens)-1]
 
@@ -190,94 +227,78 @@ func (c *Client) setValueAt(root map[string]any, path string, resp []byte) {
 	}
 }
 
+// Normalize returns tree in its JSON form, as a tree loaded from a file is:
+// lists as []any rather than the []string that SetValueAt stores for
+// newline-separated values, and numbers as float64.
+func Normalize(tree map[string]any) map[string]any {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return tree
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return tree
+	}
+	return normalized
+}
+
 // FindKey searches for a key name and returns its full path.
 func (c *Client) FindKey(ctx context.Context, key string) string {
-	for _, base := range []string{"meta-data", "dynamic"} {
-		data := c.GetAll(ctx, base)
-		if baseData, ok := data[base].(map[string]any); ok {
-			if path := findKeyIn(baseData, "", key); path != "" {
-				return base + "/" + path
-			}
-		}
-	}
-	return ""
+	return FindKey(ctx, c, key)
 }
 
-func findKeyIn(data any, prefix, key string) string {
+// findKeyIn returns the deepest paths below data whose last element is key.
+func findKeyIn(data any, prefix, key string) []string {
 	m, ok := data.(map[string]any)
 	if !ok {
-		return ""
+		return nil
 	}
 
-	var best string
+	var best []string
 	maxDepth := -1
+	add := func(paths ...string) {
+		for _, path := range paths {
+			switch depth := strings.Count(path, "/"); {
+			case depth > maxDepth:
+				best, maxDepth = []string{path}, depth
+			case depth == maxDepth:
+				best = append(best, path)
+			}
+		}
+	}
 
 	for k, v := range m {
 		path := k
 		if prefix != "" {
 			path = prefix + "/" + k
 		}
-		if k == key && strings.Count(path, "/") > maxDepth {
-			best = path
-			maxDepth = strings.Count(path, "/")
-		}
-		if found := findKeyIn(v, path, key); found != "" && strings.Count(found, "/") > maxDepth {
-			best = found
-			maxDepth = strings.Count(found, "/")
+		if k == key {
+			add(path)
 		}
+		add(findKeyIn(v, path, key)...)
 	}
 	return best
 }
 
-// Watch monitors the specified path for changes and sends updates to the returned channel.
-func (c *Client) Watch(ctx context.Context, path string) <-chan map[string]any {
-	ch := make(chan map[string]any, 10)
-	go func() {
-		defer close(ch)
-		var prev map[string]any
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
-
-		check := func() {
-			data := c.GetAll(ctx, path)
-			if !reflect.DeepEqual(prev, data) {
-				select {
-				case ch <- data:
-				default:
-					<-ch
-					ch <- data
-				}
-				prev = data
-			}
-		}
-
-		check() // Initial check
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				check()
-			}
-		}
-	}()
-	return ch
-}
-
 // NormalizePath adds the appropriate prefix (meta-data/) if not present.
 func NormalizePath(path string) string {
 	path = strings.Trim(path, "/")
 	if path == "" {
 		return ""
 	}
-	if strings.HasPrefix(path, "meta-data/") ||
-		strings.HasPrefix(path, "dynamic/") ||
-		strings.HasPrefix(path, "user-data") {
+	if IsMetadataPath(path) {
 		return path
 	}
 	return "meta-data/" + path
 }
 
+// IsMetadataPath reports whether path is one of the IMDS categories,
+// meta-data, dynamic or user-data, or below one.
+func IsMetadataPath(path string) bool {
+	category, _, _ := strings.Cut(strings.Trim(path, "/"), "/")
+	return category == "meta-data" || category == "dynamic" || category == "user-data"
+}
+
 // IsDirectory returns true if the response looks like a directory listing.
 func IsDirectory(resp []byte) bool {
 	content := strings.TrimSpace(string(resp))
@@ -298,10 +319,7 @@ func parseJSON(data []byte) (any, bool) {
 
 // AllKeys returns all leaf key names from the IMDS data.
 func (c *Client) AllKeys(ctx context.Context) []string {
-	data := c.GetAll(ctx, "")
-	var keys []string
-	collectKeys(data, &keys)
-	return keys
+	return AllKeys(ctx, c)
 }
 
 func collectKeys(data any, keys *[]string) {
@@ -309,7 +327,8 @@ func collectKeys(data any, keys *[]string) {
 	if !ok {
 		return
 	}
-	for k, v := range m {
+	for _, k := range SortedKeys(m) {
+		v := m[k]
 		if _, isMap := v.(map[string]any); isMap {
 			collectKeys(v, keys)
 		} else {
@@ -15,6 +15,7 @@ limitations under the License.
 package imds
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -28,6 +29,9 @@ func TestNormalizePath(t *testing.T) {
 		{"meta-data/instance-id", "meta-data/instance-id"},
 		{"dynamic/instance-identity/document", "dynamic/instance-identity/document"},
 		{"user-data", "user-data"},
+		{"meta-data", "meta-data"},
+		{"meta-dataiam/info", "meta-data/meta-dataiam/info"},
+		{"user-dataX", "meta-data/user-dataX"},
 		{"placement/region", "meta-data/placement/region"},
 		{"/instance-id/", "meta-data/instance-id"},
 	}
@@ -42,6 +46,22 @@ func TestNormalizePath(t *testing.T) {
 	}
 }
 
+func TestNormalize(t *testing.T) {
+	tree := map[string]any{"meta-data": map[string]any{
+		"security-groups": []string{"default", "web"},
+		"instance-id":     "i-1234567890abcdef0",
+		"launch-index":    0,
+	}}
+	want := map[string]any{"meta-data": map[string]any{
+		"security-groups": []any{"default", "web"},
+		"instance-id":     "i-1234567890abcdef0",
+		"launch-index":    float64(0),
+	}}
+	if got := Normalize(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("Normalize() = %#v, want %#v", got, want)
+	}
+}
+
 func TestIsDirectory(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,238 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bwagner5/imds/internal/glob"
+)
+
+// jsonLeaves are paths whose values IMDS serves as JSON documents, so maps
+// found there are leaves rather than directories.
+var jsonLeaves = []string{
+	"dynamic/instance-identity/document",
+	"meta-data/events/recommendations/rebalance",
+	"meta-data/iam/info",
+	"meta-data/iam/security-credentials/*",
+	"meta-data/identity-credentials/ec2/info",
+	"meta-data/identity-credentials/ec2/security-credentials/*",
+	"meta-data/spot/instance-action",
+}
+
+// Memory is a Backend holding a metadata tree in the shape produced by
+// GetAll and `imds --json`. It renders values the way IMDS would:
+// directories as listings, lists as newline-separated values and JSON
+// documents as JSON.
+type Memory struct {
+	mu   sync.RWMutex
+	tree map[string]any
+}
+
+// NewMemory creates a Memory backend for tree. The tree is owned by the Memory afterwards.
+func NewMemory(tree map[string]any) *Memory {
+	if tree == nil {
+		tree = map[string]any{}
+	}
+	return &Memory{tree: tree}
+}
+
+// Set replaces the value at path, e.g. "meta-data/spot/instance-action",
+// creating parent directories as needed.
+func (m *Memory) Set(path string, value any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := strings.Split(strings.Trim(path, "/"), "/")
+	dir := m.tree
+	for _, t := range tokens[:len(tokens)-1] {
+		next, ok := dir[t].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			dir[t] = next
+		}
+		dir = next
+	}
+	dir[tokens[len(tokens)-1]] = value
+}
+
+// Delete removes the value at path.
+func (m *Memory) Delete(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := strings.Split(strings.Trim(path, "/"), "/")
+	dir := m.tree
+	for _, t := range tokens[:len(tokens)-1] {
+		next, ok := dir[t].(map[string]any)
+		if !ok {
+			return
+		}
+		dir = next
+	}
+	delete(dir, tokens[len(tokens)-1])
+}
+
+// Get renders the value at path as IMDS would serve it.
+func (m *Memory) Get(_ context.Context, path string) ([]byte, error) {
+	path = strings.Trim(path, "/")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, ok := m.lookup(path)
+	if !ok {
+		return nil, NewError(path, http.StatusNotFound, nil)
+	}
+
+	switch v := node.(type) {
+	case map[string]any:
+		if path != "" && isJSONLeaf(path, v) {
+			return json.MarshalIndent(v, "", "  ")
+		}
+		return []byte(strings.Join(listing(path, v), "\n")), nil
+	case []any:
+		lines := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return json.MarshalIndent(v, "", "  ")
+			}
+			lines = append(lines, str)
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	case []string:
+		return []byte(strings.Join(v, "\n")), nil
+	case string:
+		return []byte(v), nil
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
+
+// List returns the names in the directory at path.
+func (m *Memory) List(ctx context.Context, path string) ([]string, error) {
+	resp, err := m.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return splitListing(resp), nil
+}
+
+// GetAll returns a copy of the tree below path, nested from the root.
+func (m *Memory) GetAll(_ context.Context, path string) map[string]any {
+	path = strings.Trim(path, "/")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if path == "" {
+		return deepCopy(m.tree).(map[string]any)
+	}
+	node, ok := m.lookup(path)
+	if !ok {
+		return map[string]any{}
+	}
+	result := map[string]any{}
+	tokens := strings.Split(path, "/")
+	dir := result
+	for _, t := range tokens[:len(tokens)-1] {
+		next := map[string]any{}
+		dir[t] = next
+		dir = next
+	}
+	dir[tokens[len(tokens)-1]] = deepCopy(node)
+	return result
+}
+
+// Watch polls the tree below path for changes.
+func (m *Memory) Watch(ctx context.Context, path string) <-chan map[string]any {
+	return Poll(ctx, m, path, WatchInterval)
+}
+
+// lookup returns the node at path. JSON documents have no children.
+func (m *Memory) lookup(path string) (any, bool) {
+	var node any = m.tree
+	if path == "" {
+		return node, true
+	}
+	cur := ""
+	for _, t := range strings.Split(path, "/") {
+		dir, ok := node.(map[string]any)
+		if !ok || (cur != "" && isJSONLeaf(cur, dir)) {
+			return nil, false
+		}
+		if node, ok = dir[t]; !ok {
+			return nil, false
+		}
+		cur = strings.TrimPrefix(cur+"/"+t, "/")
+	}
+	return node, true
+}
+
+func listing(path string, dir map[string]any) []string {
+	names := make([]string, 0, len(dir))
+	for k, v := range dir {
+		child := k
+		if path != "" {
+			child = path + "/" + k
+		}
+		if m, ok := v.(map[string]any); ok && (path == "" || !isJSONLeaf(child, m)) {
+			k += "/"
+		}
+		names = append(names, k)
+	}
+	SortListing(names)
+	return names
+}
+
+// isJSONLeaf reports whether the map at path is a JSON document rather than a
+// directory: either a known JSON path, or a map holding values such as numbers
+// that IMDS directories never contain.
+func isJSONLeaf(path string, m map[string]any) bool {
+	for _, leaf := range jsonLeaves {
+		if glob.Match(leaf, path) {
+			return true
+		}
+	}
+	for _, v := range m {
+		switch v.(type) {
+		case string, []any, []string, map[string]any:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = deepCopy(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = deepCopy(item)
+		}
+		return out
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}
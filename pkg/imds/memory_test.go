@@ -0,0 +1,61 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(map[string]any{
+		"meta-data": map[string]any{
+			"instance-id": "i-1234567890abcdef0",
+			"placement":   map[string]any{"region": "us-east-1"},
+		},
+	})
+	m.Set("meta-data/spot/instance-action", map[string]any{"action": "terminate"})
+
+	if got, err := m.List(ctx, "meta-data"); err != nil || !reflect.DeepEqual(got, []string{"placement/", "spot/", "instance-id"}) {
+		t.Errorf("List(meta-data) = %v, %v", got, err)
+	}
+	if got, err := m.List(ctx, "meta-data/spot"); err != nil || !reflect.DeepEqual(got, []string{"instance-action"}) {
+		t.Errorf("List(meta-data/spot) = %v, %v", got, err)
+	}
+	if got, err := m.Get(ctx, "meta-data/spot/instance-action"); err != nil || string(got) != "{\n  \"action\": \"terminate\"\n}" {
+		t.Errorf("Get(instance-action) = %q, %v", got, err)
+	}
+	if _, err := m.Get(ctx, "meta-data/spot/instance-action/action"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() inside a JSON document error = %v, want ErrNotFound", err)
+	}
+
+	want := map[string]any{"meta-data": map[string]any{"placement": map[string]any{"region": "us-east-1"}}}
+	if got := m.GetAll(ctx, "meta-data/placement"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll(placement) = %v, want %v", got, want)
+	}
+	if got := FindKey(ctx, m, "region"); got != "meta-data/placement/region" {
+		t.Errorf("FindKey(region) = %q", got)
+	}
+
+	m.Set("meta-data/network/interfaces/macs/0a:02/mac", "0a:02")
+	m.Set("meta-data/network/interfaces/macs/0a:01/mac", "0a:01")
+	want2 := []string{"meta-data/network/interfaces/macs/0a:01/mac", "meta-data/network/interfaces/macs/0a:02/mac"}
+	if got := FindKeys(ctx, m, "mac"); !reflect.DeepEqual(got, want2) {
+		t.Errorf("FindKeys(mac) = %v, want %v", got, want2)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Paths of the notices IMDS publishes about an instance's lifecycle.
+const (
+	SpotInstanceActionPath   = "meta-data/spot/instance-action"
+	RebalancePath            = "meta-data/events/recommendations/rebalance"
+	MaintenanceScheduledPath = "meta-data/events/maintenance/scheduled"
+	InstanceTagsPath         = "meta-data/tags/instance"
+	TargetLifecycleStatePath = "meta-data/autoscaling/target-lifecycle-state"
+)
+
+// InstanceAction is a spot interruption notice.
+type InstanceAction struct {
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+}
+
+// RebalanceRecommendation is an EC2 instance rebalance recommendation.
+type RebalanceRecommendation struct {
+	NoticeTime time.Time `json:"noticeTime"`
+}
+
+// SpotInstanceAction returns the pending spot interruption. IMDS returns 404
+// when there is none, so any error usually means no interruption is scheduled.
+func (c *Client) SpotInstanceAction(ctx context.Context) (*InstanceAction, error) {
+	resp, err := c.Get(ctx, SpotInstanceActionPath)
+	if err != nil {
+		return nil, err
+	}
+	action := &InstanceAction{}
+	if err := json.Unmarshal(resp, action); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", SpotInstanceActionPath, err)
+	}
+	return action, nil
+}
+
+// RebalanceRecommendation returns the rebalance recommendation, if one was issued.
+func (c *Client) RebalanceRecommendation(ctx context.Context) (*RebalanceRecommendation, error) {
+	resp, err := c.Get(ctx, RebalancePath)
+	if err != nil {
+		return nil, err
+	}
+	rebalance := &RebalanceRecommendation{}
+	if err := json.Unmarshal(resp, rebalance); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", RebalancePath, err)
+	}
+	return rebalance, nil
+}
+
+// TargetLifecycleState returns the Auto Scaling lifecycle state the instance is transitioning to.
+func (c *Client) TargetLifecycleState(ctx context.Context) (string, error) {
+	resp, err := c.Get(ctx, TargetLifecycleStatePath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(resp)), nil
+}
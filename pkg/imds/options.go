@@ -0,0 +1,203 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/bwagner5/imds/internal/token"
+)
+
+// MaxTokenTTL is the longest session token lifetime IMDS issues.
+const MaxTokenTTL = token.MaxTTL
+
+// Option configures a Client created by NewClient.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	transport      http.RoundTripper
+	httpClient     *http.Client
+	timeout        time.Duration
+	retryer        aws.Retryer
+	maxAttempts    int
+	tokenTTL       time.Duration
+	userAgent      string
+	noSharedConfig bool
+	endpointMode   EndpointMode
+	apiOptions     []func(*middleware.Stack) error
+}
+
+// WithTransport sends the client's HTTP requests through rt, e.g. to record
+// or replay IMDS interactions in tests.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = rt
+	}
+}
+
+// WithHTTPClient sends the client's requests through c instead of the SDK's
+// default HTTP client. WithTransport replaces c's transport.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = c
+	}
+}
+
+// WithTimeout bounds each operation, including its retries and the session
+// token request, replacing the SDK's 5s default. Deadlines on the request
+// context still apply.
+func WithTimeout(d time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = d
+	}
+}
+
+// WithRetryer replaces the SDK's standard retryer.
+func WithRetryer(r aws.Retryer) Option {
+	return func(o *clientOptions) {
+		o.retryer = r
+	}
+}
+
+// WithMaxAttempts limits each operation to n attempts, where 1 disables retries.
+func WithMaxAttempts(n int) Option {
+	return func(o *clientOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithTokenTTL requests IMDSv2 session tokens valid for d instead of the
+// SDK's 5m, so long-running clients fetch tokens less often.
+func WithTokenTTL(d time.Duration) Option {
+	return func(o *clientOptions) {
+		o.tokenTTL = d
+	}
+}
+
+// WithUserAgent appends product to the User-Agent of every request, e.g. "my-app/1.2".
+func WithUserAgent(product string) Option {
+	return func(o *clientOptions) {
+		o.userAgent = product
+	}
+}
+
+// WithoutSharedConfig configures the client from its options alone, without
+// reading ~/.aws config files or AWS_* environment variables, so creating it
+// is cheap and behaves the same everywhere.
+func WithoutSharedConfig() Option {
+	return func(o *clientOptions) {
+		o.noSharedConfig = true
+	}
+}
+
+// validate checks the options and normalizes the endpoint mode.
+func (o *clientOptions) validate() error {
+	if o.timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", o.timeout)
+	}
+	if o.maxAttempts < 0 {
+		return fmt.Errorf("max attempts must not be negative, got %d", o.maxAttempts)
+	}
+	mode, err := ParseEndpointMode(string(o.endpointMode))
+	if err != nil {
+		return err
+	}
+	o.endpointMode = mode
+	if o.tokenTTL != 0 && (o.tokenTTL < time.Second || o.tokenTTL > MaxTokenTTL) {
+		return fmt.Errorf("token TTL must be between 1s and %s, got %s", MaxTokenTTL, o.tokenTTL)
+	}
+	return nil
+}
+
+// client returns the HTTP client to use, or nil for the SDK's default.
+func (o *clientOptions) client() *http.Client {
+	if o.httpClient == nil && o.transport == nil {
+		return nil
+	}
+	c := &http.Client{}
+	if o.httpClient != nil {
+		*c = *o.httpClient
+	}
+	if o.transport != nil {
+		c.Transport = o.transport
+	}
+	return c
+}
+
+// apply sets the options on the SDK client's options.
+func (o *clientOptions) apply(sdkOpts *imds.Options) {
+	if c := o.client(); c != nil {
+		sdkOpts.HTTPClient = c
+	}
+	if o.retryer != nil {
+		sdkOpts.Retryer = o.retryer
+	}
+	if o.maxAttempts > 0 {
+		if sdkOpts.Retryer == nil {
+			sdkOpts.Retryer = retry.NewStandard()
+		}
+		sdkOpts.Retryer = retry.AddWithMaxAttempts(sdkOpts.Retryer, o.maxAttempts)
+	}
+	if o.timeout > 0 {
+		sdkOpts.DisableDefaultTimeout = true
+		sdkOpts.APIOptions = append(sdkOpts.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(operationTimeout(o.timeout), middleware.Before)
+		})
+	}
+	if o.tokenTTL > 0 {
+		sdkOpts.APIOptions = append(sdkOpts.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Build.Add(tokenTTL(o.tokenTTL), middleware.After)
+		})
+	}
+	sdkOpts.APIOptions = append(sdkOpts.APIOptions, o.apiOptions...)
+	if o.userAgent != "" {
+		name, version, _ := strings.Cut(o.userAgent, "/")
+		sdkOpts.APIOptions = append(sdkOpts.APIOptions, awsmiddleware.AddUserAgentKeyValue(name, version))
+	}
+}
+
+// operationTimeout bounds each operation like the SDK's default timeout, but
+// for d and even when the context already has a later deadline.
+func operationTimeout(d time.Duration) middleware.InitializeMiddleware {
+	return middleware.InitializeMiddlewareFunc("IMDSOperationTimeout", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return next.HandleInitialize(ctx, in)
+	})
+}
+
+// tokenTTL rewrites the TTL of session token requests. The SDK reads the
+// token's lifetime back from the response, so it refreshes tokens on time.
+func tokenTTL(d time.Duration) middleware.BuildMiddleware {
+	seconds := strconv.Itoa(int(d / time.Second))
+	return middleware.BuildMiddlewareFunc("IMDSTokenTTL", func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok && req.Method == http.MethodPut && strings.HasSuffix(req.URL.Path, token.Path) {
+			req.Header.Set(token.TTLHeader, seconds)
+		}
+		return next.HandleBuild(ctx, in)
+	})
+}
@@ -0,0 +1,131 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIMDS answers token requests and GETs of meta-data/instance-id, and
+// records the requests it gets.
+type fakeIMDS struct {
+	status int
+	delay  time.Duration
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (f *fakeIMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.mu.Unlock()
+	if r.Method == http.MethodPut {
+		w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+		_, _ = w.Write([]byte("token"))
+		return
+	}
+	time.Sleep(f.delay)
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	_, _ = w.Write([]byte("i-1234567890abcdef0"))
+}
+
+func (f *fakeIMDS) gets() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var gets []*http.Request
+	for _, r := range f.requests {
+		if r.Method == http.MethodGet {
+			gets = append(gets, r)
+		}
+	}
+	return gets
+}
+
+func TestClientOptions(t *testing.T) {
+	ctx := context.Background()
+	// A profile that does not exist fails shared config loading, which
+	// WithoutSharedConfig must skip.
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_PROFILE", "missing")
+
+	fake := &fakeIMDS{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := NewClient(ctx, server.URL, WithoutSharedConfig(), WithTokenTTL(time.Hour), WithUserAgent("my-app/1.2"))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if resp, err := client.Get(ctx, "meta-data/instance-id"); err != nil || string(resp) != "i-1234567890abcdef0" {
+		t.Fatalf("Get() = %q, %v", resp, err)
+	}
+	fake.mu.Lock()
+	put := fake.requests[0]
+	fake.mu.Unlock()
+	if put.Method != http.MethodPut || put.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds") != "3600" {
+		t.Errorf("token request = %s with TTL %q, want PUT with TTL 3600", put.Method, put.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+	}
+	if ua := fake.gets()[0].UserAgent(); !strings.Contains(ua, "my-app/1.2") {
+		t.Errorf("User-Agent = %q, want it to contain my-app/1.2", ua)
+	}
+
+	fake.status = http.StatusServiceUnavailable
+	client, err = NewClient(ctx, server.URL, WithoutSharedConfig(), WithMaxAttempts(1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	before := len(fake.gets())
+	if _, err := client.Get(ctx, "meta-data/instance-id"); err == nil {
+		t.Error("Get() succeeded against a failing server")
+	}
+	if n := len(fake.gets()) - before; n != 1 {
+		t.Errorf("WithMaxAttempts(1) made %d attempts", n)
+	}
+
+	fake.status, fake.delay = 0, 500*time.Millisecond
+	client, err = NewClient(ctx, server.URL, WithoutSharedConfig(), WithTimeout(50*time.Millisecond), WithMaxAttempts(1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	start := time.Now()
+	if _, err := client.Get(ctx, "meta-data/instance-id"); err == nil {
+		t.Error("Get() succeeded past its timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Get() took %s with a 50ms timeout", elapsed)
+	}
+
+	if _, err := NewClient(ctx, server.URL); err == nil {
+		t.Error("NewClient() with a missing profile succeeded")
+	}
+}
+
+func TestClientOptionsValidate(t *testing.T) {
+	for _, opt := range []Option{WithTokenTTL(12 * time.Hour), WithTokenTTL(time.Millisecond), WithTimeout(-time.Second), WithMaxAttempts(-1)} {
+		if _, err := NewClient(context.Background(), "", WithoutSharedConfig(), opt); err == nil {
+			t.Error("NewClient() with an invalid option succeeded")
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// CompareKeys orders IMDS key names naturally, comparing runs of digits by
+// value so that ebs2 sorts before ebs10 and public key 2 before 10.
+func CompareKeys(a, b string) int {
+	x, y := a, b
+	for x != "" && y != "" {
+		dx, dy := digits(x), digits(y)
+		if dx > 0 && dy > 0 {
+			nx, ny := strings.TrimLeft(x[:dx], "0"), strings.TrimLeft(y[:dy], "0")
+			if c := cmp.Or(cmp.Compare(len(nx), len(ny)), strings.Compare(nx, ny)); c != 0 {
+				return c
+			}
+			x, y = x[dx:], y[dy:]
+			continue
+		}
+		if x[0] != y[0] {
+			return cmp.Compare(x[0], y[0])
+		}
+		x, y = x[1:], y[1:]
+	}
+	// Equal but for leading zeros falls back to byte order.
+	return cmp.Or(cmp.Compare(len(x), len(y)), strings.Compare(a, b))
+}
+
+// digits returns the length of the run of ASCII digits s starts with.
+func digits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// SortedKeys returns the keys of m in display order: directories (nested
+// maps) first, then leaves, each in CompareKeys order.
+func SortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		_, aDir := m[a].(map[string]any)
+		_, bDir := m[b].(map[string]any)
+		if aDir != bDir {
+			if aDir {
+				return -1
+			}
+			return 1
+		}
+		return CompareKeys(a, b)
+	})
+	return keys
+}
+
+// SortListing sorts the names in a directory listing in display order:
+// directories (named with a trailing "/") first, then leaves, each in
+// CompareKeys order.
+func SortListing(names []string) {
+	slices.SortFunc(names, func(a, b string) int {
+		aDir, bDir := strings.HasSuffix(a, "/"), strings.HasSuffix(b, "/")
+		if aDir != bDir {
+			if aDir {
+				return -1
+			}
+			return 1
+		}
+		return CompareKeys(a, b)
+	})
+}
+
+// MarshalIndent is json.MarshalIndent with the keys of every map[string]any
+// in SortedKeys order, so output is stable and reads like the IMDS tree.
+func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeSorted(&buf, v); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), prefix, indent); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func encodeSorted(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		buf.WriteByte('{')
+		for i, k := range SortedKeys(v) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(k)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := encodeSorted(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeSorted(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestCompareKeys(t *testing.T) {
+	keys := []string{"ebs10", "root", "ebs2", "ami", "ebs1", "10=key-c", "2=key-b", "0=key-a", "eth02", "eth2", "eth1"}
+	slices.SortFunc(keys, CompareKeys)
+	want := []string{"0=key-a", "2=key-b", "10=key-c", "ami", "ebs1", "ebs2", "ebs10", "eth1", "eth02", "eth2", "root"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("sorted = %v, want %v", keys, want)
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	m := map[string]any{
+		"instance-id":          "i-1234567890abcdef0",
+		"placement":            map[string]any{},
+		"block-device-mapping": map[string]any{},
+		"ami-id":               "ami-1",
+		"security-groups":      []any{"a", "b"},
+	}
+	want := []string{"block-device-mapping", "placement", "ami-id", "instance-id", "security-groups"}
+	if got := SortedKeys(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestSortListing(t *testing.T) {
+	names := []string{"instance-id", "public-keys/", "ami-id", "block-device-mapping/", "ebs10", "ebs2"}
+	SortListing(names)
+	want := []string{"block-device-mapping/", "public-keys/", "ami-id", "ebs2", "ebs10", "instance-id"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("SortListing() = %v, want %v", names, want)
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	data := map[string]any{
+		"meta-data": map[string]any{
+			"instance-id": "i-1234567890abcdef0",
+			"block-device-mapping": map[string]any{
+				"ebs10": "sdk",
+				"ebs2":  "sdc",
+			},
+			"security-groups": []any{"a", map[string]any{"b": 1, "a": true}},
+		},
+	}
+	want := `{
+  "meta-data": {
+    "block-device-mapping": {
+      "ebs2": "sdc",
+      "ebs10": "sdk"
+    },
+    "instance-id": "i-1234567890abcdef0",
+    "security-groups": [
+      "a",
+      {
+        "a": true,
+        "b": 1
+      }
+    ]
+  }
+}`
+	for i := 0; i < 5; i++ {
+		got, err := MarshalIndent(data, "", "  ")
+		if err != nil || string(got) != want {
+			t.Fatalf("MarshalIndent() = %s, %v, want %s", got, err, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bwagner5/imds/internal/token"
+)
+
+// DefaultDMIRoot is where Linux exposes the DMI (SMBIOS) identifiers that
+// name the hardware vendor.
+const DefaultDMIRoot = "/sys/devices/virtual/dmi/id"
+
+// DefaultProbeTimeout bounds Probe unless ProbeOptions.Timeout is set.
+const DefaultProbeTimeout = time.Second
+
+// Environment is where Probe found the client to be running.
+type Environment string
+
+const (
+	// EnvironmentEC2 means IMDS answered.
+	EnvironmentEC2 Environment = "ec2"
+	// EnvironmentNotEC2 means IMDS did not answer and the hardware is not EC2.
+	EnvironmentNotEC2 Environment = "not-ec2"
+	// EnvironmentUnreachable means IMDS did not answer although the hardware
+	// is EC2 or unknown, e.g. because IMDS is disabled, the hop limit is too
+	// low for a container or a custom endpoint is down.
+	EnvironmentUnreachable Environment = "unreachable"
+)
+
+// ProbeOptions configures Probe.
+type ProbeOptions struct {
+	// Timeout bounds the probe, DefaultProbeTimeout if zero.
+	Timeout time.Duration
+	// DMIRoot is where DMI identifiers are read, DefaultDMIRoot if empty.
+	DMIRoot string
+	// SkipDMI disables the hardware check.
+	SkipDMI bool
+}
+
+// ProbeResult is what Probe found.
+type ProbeResult struct {
+	Environment Environment
+	// Err is why IMDS did not answer, or nil.
+	Err error
+	// DMIChecked is set if DMI identifiers could be read, and EC2Hardware if
+	// they name Amazon EC2.
+	DMIChecked  bool
+	EC2Hardware bool
+}
+
+// Probe quickly determines whether IMDS is available, with a single
+// short-timeout token request and no retries, so callers can fail fast off EC2
+// rather than waiting through retries and crawls.
+func (c *Client) Probe(ctx context.Context, opts ProbeOptions) ProbeResult {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := ProbeResult{Environment: EnvironmentEC2}
+	// Any response to a token request, even an error, means IMDS is there.
+	if result.Err = c.probeToken(ctx); result.Err == nil {
+		return result
+	}
+
+	if !opts.SkipDMI {
+		root := opts.DMIRoot
+		if root == "" {
+			root = DefaultDMIRoot
+		}
+		result.EC2Hardware, result.DMIChecked = DetectEC2Hardware(root)
+	}
+	switch {
+	case result.DMIChecked && !result.EC2Hardware:
+		result.Environment = EnvironmentNotEC2
+	case !result.DMIChecked && (c.endpoint == DefaultEndpoint || c.endpoint == DefaultIPv6Endpoint):
+		// Without DMI, e.g. on macOS, a silent link-local endpoint is the
+		// best sign of not being on EC2.
+		result.Environment = EnvironmentNotEC2
+	default:
+		result.Environment = EnvironmentUnreachable
+	}
+	return result
+}
+
+// probeToken sends one token request, returning an error only if no response
+// was received.
+func (c *Client) probeToken(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(c.endpoint, "/")+token.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(token.TTLHeader, "60")
+	client := c.http
+	if client == nil {
+		client = &http.Client{}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return NewError(strings.TrimPrefix(token.Path, "/latest/"), 0, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DetectEC2Hardware reads the DMI identifiers under root and reports whether
+// they name Amazon EC2, and whether any could be read at all.
+func DetectEC2Hardware(root string) (ec2 bool, ok bool) {
+	for _, name := range []string{"sys_vendor", "bios_vendor", "bios_version", "product_name", "product_uuid", "board_asset_tag"} {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+		ok = true
+		value := strings.ToLower(strings.TrimSpace(string(data)))
+		switch name {
+		case "product_uuid":
+			ec2 = ec2 || strings.HasPrefix(value, "ec2")
+		case "board_asset_tag":
+			ec2 = ec2 || strings.HasPrefix(value, "i-")
+		default:
+			ec2 = ec2 || strings.Contains(value, "amazon")
+		}
+	}
+	return ec2, ok
+}
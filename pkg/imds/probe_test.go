@@ -0,0 +1,96 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeDMI(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			issueToken(w)
+			return
+		}
+		_, _ = w.Write([]byte("i-1234567890abcdef0"))
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	nitro := writeDMI(t, map[string]string{"sys_vendor": "Amazon EC2", "board_asset_tag": "i-1234567890abcdef0"})
+	xen := writeDMI(t, map[string]string{"bios_version": "4.11.amazon", "product_uuid": "EC2E1916-9099-7CAF-FD21-012345678910"})
+	laptop := writeDMI(t, map[string]string{"sys_vendor": "LENOVO", "product_name": "20XW"})
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name     string
+		endpoint string
+		dmi      string
+		want     Environment
+	}{
+		{"imds answers", up.URL, laptop, EnvironmentEC2},
+		{"laptop", down.URL, laptop, EnvironmentNotEC2},
+		{"nitro without imds", down.URL, nitro, EnvironmentUnreachable},
+		{"xen without imds", down.URL, xen, EnvironmentUnreachable},
+		{"custom endpoint down without dmi", down.URL, missing, EnvironmentUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(ctx, tt.endpoint, WithoutSharedConfig())
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			start := time.Now()
+			result := client.Probe(ctx, ProbeOptions{DMIRoot: tt.dmi, Timeout: 500 * time.Millisecond})
+			if result.Environment != tt.want {
+				t.Errorf("Probe() = %+v, want %s", result, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Probe() took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestDetectEC2Hardware(t *testing.T) {
+	if ec2, ok := DetectEC2Hardware(writeDMI(t, map[string]string{"sys_vendor": "Amazon EC2"})); !ec2 || !ok {
+		t.Errorf("DetectEC2Hardware(Amazon EC2) = %v, %v", ec2, ok)
+	}
+	if ec2, ok := DetectEC2Hardware(writeDMI(t, map[string]string{"sys_vendor": "QEMU"})); ec2 || !ok {
+		t.Errorf("DetectEC2Hardware(QEMU) = %v, %v", ec2, ok)
+	}
+	if _, ok := DetectEC2Hardware(filepath.Join(t.TempDir(), "missing")); ok {
+		t.Error("DetectEC2Hardware() of a missing root reported DMI")
+	}
+}
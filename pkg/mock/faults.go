@@ -0,0 +1,169 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bwagner5/imds/internal/glob"
+)
+
+// Faults configures misbehaviour injected by the Server.
+//
+//	requireToken: true        # IMDSv1 disabled
+//	tokenExpiry: 30s          # tokens expire after 30s whatever TTL was requested
+//	rejectForwarded: true     # 403 on token PUTs carrying X-Forwarded-For
+//	rules:
+//	  - path: "**"
+//	    latency: 200ms
+//	  - path: meta-data/iam/**
+//	    status: 429
+//	    burst: 5
+//	  - path: api/token
+//	    drop: true
+//	    probability: 0.1
+type Faults struct {
+	// RequireToken rejects GETs without a session token, like an instance with IMDSv1 disabled.
+	RequireToken bool `yaml:"requireToken" json:"requireToken,omitempty"`
+	// TokenExpiry makes tokens expire early so that clients see 401s on tokens they believe are valid.
+	TokenExpiry time.Duration `yaml:"tokenExpiry" json:"tokenExpiry,omitempty"`
+	// RejectForwarded rejects token PUTs carrying X-Forwarded-For with 403, as IMDS does.
+	RejectForwarded bool    `yaml:"rejectForwarded" json:"rejectForwarded,omitempty"`
+	Rules           []Fault `yaml:"rules" json:"rules,omitempty"`
+}
+
+// Fault is injected into requests for paths below /latest matching Path,
+// where "*" matches within one segment and "**" matches any number of
+// segments. An empty Path matches every request.
+type Fault struct {
+	Path    string        `yaml:"path" json:"path,omitempty"`
+	Latency time.Duration `yaml:"latency" json:"latency,omitempty"`
+	// Status responds with this status code instead of the value, e.g. 429 or 503.
+	Status int `yaml:"status" json:"status,omitempty"`
+	// Drop closes the connection without responding.
+	Drop bool `yaml:"drop" json:"drop,omitempty"`
+	// Burst limits Status and Drop to the first Burst matching requests; zero means every request.
+	Burst int `yaml:"burst" json:"burst,omitempty"`
+	// Probability applies Status and Drop to this fraction of matching requests; zero means every request.
+	Probability float64 `yaml:"probability" json:"probability,omitempty"`
+}
+
+// LoadFaults reads and validates a faults file.
+func LoadFaults(path string) (*Faults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	faults := &Faults{}
+	if err := yaml.Unmarshal(data, faults); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := faults.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+	return faults, nil
+}
+
+// Validate checks the faults.
+func (f *Faults) Validate() error {
+	if f.TokenExpiry < 0 {
+		return fmt.Errorf("tokenExpiry must not be negative")
+	}
+	for i, rule := range f.Rules {
+		if rule.Latency < 0 || rule.Burst < 0 {
+			return fmt.Errorf("rule %d: latency and burst must not be negative", i)
+		}
+		if rule.Status != 0 && (rule.Status < 100 || rule.Status > 599) {
+			return fmt.Errorf("rule %d: invalid status %d", i, rule.Status)
+		}
+		if rule.Probability < 0 || rule.Probability > 1 {
+			return fmt.Errorf("rule %d: probability must be between 0 and 1", i)
+		}
+		if rule.Latency == 0 && rule.Status == 0 && !rule.Drop {
+			return fmt.Errorf("rule %d: one of latency, status or drop is required", i)
+		}
+	}
+	return nil
+}
+
+// SetFaults replaces the injected faults. A nil f removes them.
+func (s *Server) SetFaults(f *Faults) {
+	if f == nil {
+		f = &Faults{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+	s.faultHits = make([]int, len(f.Rules))
+	s.tokens.SetExpireAfter(f.TokenExpiry)
+}
+
+// Faults returns the injected faults.
+func (s *Server) Faults() *Faults {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.faults
+}
+
+// injectFault applies the rules matching path and reports whether the
+// request was answered by a fault.
+func (s *Server) injectFault(w http.ResponseWriter, r *http.Request, path string) bool {
+	var latency time.Duration
+	var fault *Fault
+	s.mu.Lock()
+	for i := range s.faults.Rules {
+		rule := &s.faults.Rules[i]
+		if rule.Path != "" && !glob.Match(rule.Path, path) {
+			continue
+		}
+		latency += rule.Latency
+		if fault != nil || (rule.Status == 0 && !rule.Drop) {
+			continue
+		}
+		if rule.Burst > 0 && s.faultHits[i] >= rule.Burst {
+			continue
+		}
+		if rule.Probability > 0 && rand.Float64() >= rule.Probability {
+			continue
+		}
+		s.faultHits[i]++
+		fault = rule
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	switch {
+	case fault == nil:
+		return false
+	case fault.Drop:
+		// Aborting the handler makes net/http close the connection without a response.
+		panic(http.ErrAbortHandler)
+	default:
+		w.WriteHeader(fault.Status)
+		return true
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwagner5/imds/internal/token"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  Faults
+		wantErr bool
+		minTime time.Duration
+	}{
+		{"latency", Faults{Rules: []Fault{{Path: "**", Latency: 100 * time.Millisecond}}}, false, 100 * time.Millisecond},
+		{"throttling burst is retried", Faults{Rules: []Fault{{Path: "meta-data/*", Status: http.StatusServiceUnavailable, Burst: 2}}}, false, 0},
+		{"persistent throttling", Faults{Rules: []Fault{{Path: "meta-data/**", Status: http.StatusTooManyRequests}}}, true, 0},
+		{"other paths unaffected", Faults{Rules: []Fault{{Path: "user-data", Status: http.StatusTooManyRequests}}}, false, 0},
+		{"dropped connection", Faults{Rules: []Fault{{Drop: true}}}, true, 0},
+		{"token throttling falls back to IMDSv1", Faults{Rules: []Fault{{Path: "api/token", Status: http.StatusServiceUnavailable}}}, false, 0},
+		{"token throttling with IMDSv1 disabled", Faults{RequireToken: true, Rules: []Fault{{Path: "api/token", Status: http.StatusServiceUnavailable}}}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			s, url := newTestServer(t, Options{})
+			s.SetFaults(&tt.faults)
+			client, err := imds.NewClient(ctx, url)
+			if err != nil {
+				t.Fatalf("creating client: %v", err)
+			}
+
+			start := time.Now()
+			got, err := client.Get(ctx, "meta-data/instance-id")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Get() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil || string(got) != "i-1234567890abcdef0" {
+				t.Errorf("Get() = %s, %v", got, err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minTime {
+				t.Errorf("Get() took %s, want at least %s", elapsed, tt.minTime)
+			}
+		})
+	}
+}
+
+func TestTokenFaults(t *testing.T) {
+	s, url := newTestServer(t, Options{})
+	s.SetFaults(&Faults{RequireToken: true, RejectForwarded: true})
+
+	resp, err := http.Get(url + "/latest/meta-data/instance-id")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without token = %d, want 401", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, url+token.Path, nil)
+	req.Header.Set(token.TTLHeader, "60")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("token PUT with X-Forwarded-For = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	s, url := newTestServer(t, Options{})
+	s.SetFaults(&Faults{TokenExpiry: 50 * time.Millisecond})
+	client, err := imds.NewClient(ctx, url)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	if _, err := client.Get(ctx, "meta-data/instance-id"); err != nil {
+		t.Fatalf("first Get() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	// The client still believes its token is valid, so it sees a 401 and must fetch a new one.
+	if _, err := client.Get(ctx, "meta-data/instance-id"); err != nil {
+		t.Errorf("Get() with expired token error = %v", err)
+	}
+}
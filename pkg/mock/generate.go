@@ -0,0 +1,345 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Shape describes the instance Generate synthesizes metadata for. Zero
+// values get defaults.
+type Shape struct {
+	InstanceType     string            `json:"instanceType"`     // default m5.large
+	Region           string            `json:"region"`           // default us-east-1
+	AvailabilityZone string            `json:"availabilityZone"` // default the region's "a" zone
+	ENIs             int               `json:"enis"`             // default 1
+	IPv6             bool              `json:"ipv6"`
+	Spot             bool              `json:"spot"`
+	Tags             map[string]string `json:"tags"`
+	IAMRole          string            `json:"iamRole"`
+	UserData         string            `json:"userData"`
+	// Seed makes identifiers and addresses differ between instances; the same
+	// seed always generates the same tree.
+	Seed uint64 `json:"seed"`
+}
+
+var (
+	instanceTypePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*\.[a-z0-9]+$`)
+	regionPattern       = regexp.MustCompile(`^([a-z]{2})-(gov-)?([a-z]+)-(\d+)$`)
+)
+
+// Generate synthesizes a metadata tree for shape in the shape produced by
+// `imds --json`, with values that agree across keys: MACs match the network
+// interfaces, the availability zone is in the region, and the identity
+// document describes the same instance.
+func Generate(shape Shape) (map[string]any, error) {
+	if err := shape.defaults(); err != nil {
+		return nil, err
+	}
+	g := &generator{rng: rand.New(rand.NewPCG(shape.Seed, 0x696d6473))}
+	regionParts := regionPattern.FindStringSubmatch(shape.Region)
+	partition, domain := "aws", "amazonaws.com"
+	switch {
+	case strings.HasPrefix(shape.Region, "cn-"):
+		partition, domain = "aws-cn", "amazonaws.com.cn"
+	case strings.HasPrefix(shape.Region, "us-gov-"):
+		partition = "aws-us-gov"
+	}
+	azLetter := strings.TrimPrefix(shape.AvailabilityZone, shape.Region)
+	// GovCloud zone IDs mark the partition with a "g", e.g. usgw1-az1.
+	azPrefix := regionParts[1]
+	if regionParts[2] != "" {
+		azPrefix += "g"
+	}
+	azID := fmt.Sprintf("%s%s%s-az%d", azPrefix, shortDirection(regionParts[3]), regionParts[4], int(azLetter[0]-'a')+1)
+
+	accountID := g.digits(12)
+	instanceID := "i-" + g.hex(17)
+	amiID := "ami-" + g.hex(17)
+	vpcID := "vpc-" + g.hex(17)
+	subnetID := "subnet-" + g.hex(17)
+	sgID := "sg-" + g.hex(17)
+	subnetIndex := int(azLetter[0] - 'a')
+	vpcCIDR := netip.MustParsePrefix("10.0.0.0/16")
+	subnetCIDR := netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(subnetIndex * 16), 0}), 20)
+	vpcIPv6 := fmt.Sprintf("2600:1f18:%04x:%02x00::/56", g.rng.IntN(0x10000), g.rng.IntN(0x100))
+	subnetIPv6 := strings.Replace(vpcIPv6, "00::/56", fmt.Sprintf("%02x::/64", subnetIndex), 1)
+	pendingTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(g.rng.IntN(365*24*3600)) * time.Second)
+
+	internalDomain := shape.Region + ".compute.internal"
+	if shape.Region == "us-east-1" {
+		internalDomain = "ec2.internal"
+	}
+	hostname := func(ip netip.Addr) string {
+		return "ip-" + strings.ReplaceAll(ip.String(), ".", "-") + "." + internalDomain
+	}
+
+	publicIP := netip.AddrFrom4([4]byte{3, byte(g.rng.IntN(256)), byte(g.rng.IntN(256)), byte(1 + g.rng.IntN(254))})
+	publicHostname := "ec2-" + strings.ReplaceAll(publicIP.String(), ".", "-") + "." + shape.Region + ".compute." + domain
+	if shape.Region == "us-east-1" {
+		publicHostname = "ec2-" + strings.ReplaceAll(publicIP.String(), ".", "-") + ".compute-1." + domain
+	}
+
+	var primaryMAC string
+	var primaryIP netip.Addr
+	var primaryIPv6 string
+	macs := map[string]any{}
+	privateIPs := map[netip.Addr]bool{}
+	for device := 0; device < shape.ENIs; device++ {
+		// Draw again on a collision so no two ENIs share a MAC or address.
+		mac := g.mac()
+		for macs[mac] != nil {
+			mac = g.mac()
+		}
+		ip := g.privateIP(subnetIndex)
+		for privateIPs[ip] {
+			ip = g.privateIP(subnetIndex)
+		}
+		privateIPs[ip] = true
+		eni := map[string]any{
+			"device-number":          fmt.Sprint(device),
+			"interface-id":           "eni-" + g.hex(17),
+			"local-hostname":         hostname(ip),
+			"local-ipv4s":            ip.String(),
+			"mac":                    mac,
+			"network-card-index":     "0",
+			"owner-id":               accountID,
+			"security-group-ids":     sgID,
+			"security-groups":        "default",
+			"subnet-id":              subnetID,
+			"subnet-ipv4-cidr-block": subnetCIDR.String(),
+			"vpc-id":                 vpcID,
+			"vpc-ipv4-cidr-block":    vpcCIDR.String(),
+			"vpc-ipv4-cidr-blocks":   vpcCIDR.String(),
+		}
+		var ipv6 string
+		if shape.IPv6 {
+			ipv6 = strings.TrimSuffix(subnetIPv6, "::/64") + fmt.Sprintf(":%x:%x:%x:%x", g.rng.IntN(0x10000), g.rng.IntN(0x10000), g.rng.IntN(0x10000), g.rng.IntN(0x10000))
+			eni["ipv6s"] = ipv6
+			eni["subnet-ipv6-cidr-blocks"] = subnetIPv6
+			eni["vpc-ipv6-cidr-blocks"] = vpcIPv6
+		}
+		if device == 0 {
+			primaryMAC, primaryIP, primaryIPv6 = mac, ip, ipv6
+			eni["public-hostname"] = publicHostname
+			eni["public-ipv4s"] = publicIP.String()
+			eni["ipv4-associations"] = map[string]any{publicIP.String(): ip.String()}
+		}
+		macs[mac] = eni
+	}
+
+	lifecycle := "on-demand"
+	if shape.Spot {
+		lifecycle = "spot"
+	}
+	metadata := map[string]any{
+		"ami-id":            amiID,
+		"ami-launch-index":  "0",
+		"ami-manifest-path": "(unknown)",
+		"block-device-mapping": map[string]any{
+			"ami":  "/dev/xvda",
+			"root": "/dev/xvda",
+		},
+		"hostname":            hostname(primaryIP),
+		"instance-action":     "none",
+		"instance-id":         instanceID,
+		"instance-life-cycle": lifecycle,
+		"instance-type":       shape.InstanceType,
+		"local-hostname":      hostname(primaryIP),
+		"local-ipv4":          primaryIP.String(),
+		"mac":                 primaryMAC,
+		"network":             map[string]any{"interfaces": map[string]any{"macs": macs}},
+		"placement": map[string]any{
+			"availability-zone":    shape.AvailabilityZone,
+			"availability-zone-id": azID,
+			"region":               shape.Region,
+		},
+		"profile":         "default-hvm",
+		"public-hostname": publicHostname,
+		"public-ipv4":     publicIP.String(),
+		"reservation-id":  "r-" + g.hex(17),
+		"security-groups": "default",
+		"services":        map[string]any{"domain": domain, "partition": partition},
+	}
+	if shape.IPv6 {
+		metadata["ipv6"] = primaryIPv6
+	}
+	if len(shape.Tags) > 0 {
+		tags := map[string]any{}
+		for k, v := range shape.Tags {
+			tags[k] = v
+		}
+		metadata["tags"] = map[string]any{"instance": tags}
+	}
+	if shape.IAMRole != "" {
+		updated := pendingTime.Format(time.RFC3339)
+		metadata["iam"] = map[string]any{
+			"info": map[string]any{
+				"Code":               "Success",
+				"LastUpdated":        updated,
+				"InstanceProfileArn": fmt.Sprintf("arn:%s:iam::%s:instance-profile/%s", partition, accountID, shape.IAMRole),
+				"InstanceProfileId":  "AIPA" + strings.ToUpper(g.hex(17)),
+			},
+			"security-credentials": map[string]any{
+				shape.IAMRole: map[string]any{
+					"Code":            "Success",
+					"LastUpdated":     updated,
+					"Type":            "AWS-HMAC",
+					"AccessKeyId":     "ASIA" + strings.ToUpper(g.hex(16)),
+					"SecretAccessKey": g.base64(30),
+					"Token":           g.base64(300),
+					"Expiration":      pendingTime.Add(6 * time.Hour).Format(time.RFC3339),
+				},
+			},
+		}
+	}
+
+	tree := map[string]any{
+		"meta-data": metadata,
+		"dynamic": map[string]any{
+			"instance-identity": map[string]any{
+				"document": map[string]any{
+					"accountId":               accountID,
+					"architecture":            architecture(shape.InstanceType),
+					"availabilityZone":        shape.AvailabilityZone,
+					"billingProducts":         nil,
+					"devpayProductCodes":      nil,
+					"marketplaceProductCodes": nil,
+					"imageId":                 amiID,
+					"instanceId":              instanceID,
+					"instanceType":            shape.InstanceType,
+					"kernelId":                nil,
+					"pendingTime":             pendingTime.Format(time.RFC3339),
+					"privateIp":               primaryIP.String(),
+					"ramdiskId":               nil,
+					"region":                  shape.Region,
+					"version":                 "2017-09-30",
+				},
+				"pkcs7":     g.base64(768),
+				"rsa2048":   g.base64(1024),
+				"signature": g.base64(128),
+			},
+		},
+	}
+	if shape.UserData != "" {
+		tree["user-data"] = shape.UserData
+	}
+	return tree, nil
+}
+
+func (s *Shape) defaults() error {
+	if s.InstanceType == "" {
+		s.InstanceType = "m5.large"
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.AvailabilityZone == "" {
+		s.AvailabilityZone = s.Region + "a"
+	}
+	if s.ENIs == 0 {
+		s.ENIs = 1
+	}
+	if !instanceTypePattern.MatchString(s.InstanceType) {
+		return fmt.Errorf("invalid instance type %q, want e.g. m5.large", s.InstanceType)
+	}
+	if !regionPattern.MatchString(s.Region) {
+		return fmt.Errorf("invalid region %q, want e.g. us-east-1", s.Region)
+	}
+	if letter := strings.TrimPrefix(s.AvailabilityZone, s.Region); len(letter) != 1 || letter == s.AvailabilityZone || letter[0] < 'a' || letter[0] > 'f' {
+		return fmt.Errorf("availability zone %q is not in region %s", s.AvailabilityZone, s.Region)
+	}
+	if s.ENIs < 1 || s.ENIs > 15 {
+		return fmt.Errorf("enis must be between 1 and 15, got %d", s.ENIs)
+	}
+	return nil
+}
+
+// shortDirection abbreviates the direction in a region name as availability
+// zone IDs do, e.g. "southeast" to "se".
+func shortDirection(direction string) string {
+	for _, full := range []string{"north", "south", "east", "west", "central"} {
+		direction = strings.Replace(direction, full, full[:1], 1)
+	}
+	return direction
+}
+
+// architecture guesses the architecture from the instance family, where a
+// "g" after the generation marks Graviton, e.g. m6g or c7gn.
+func architecture(instanceType string) string {
+	family, _, _ := strings.Cut(instanceType, ".")
+	if i := strings.IndexAny(family, "0123456789"); i >= 0 && strings.HasPrefix(family[i+1:], "g") {
+		return "arm64"
+	}
+	return "x86_64"
+}
+
+type generator struct {
+	rng *rand.Rand
+}
+
+func (g *generator) hex(n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = digits[g.rng.IntN(len(digits))]
+	}
+	return string(b)
+}
+
+func (g *generator) mac() string {
+	return fmt.Sprintf("0e:%02x:%02x:%02x:%02x:%02x", g.rng.IntN(256), g.rng.IntN(256), g.rng.IntN(256), g.rng.IntN(256), g.rng.IntN(256))
+}
+
+// privateIP returns an address in the /20 subnet of the given index, skipping
+// the addresses AWS reserves at its start.
+func (g *generator) privateIP(subnetIndex int) netip.Addr {
+	return netip.AddrFrom4([4]byte{10, 0, byte(subnetIndex*16 + g.rng.IntN(16)), byte(4 + g.rng.IntN(250))})
+}
+
+func (g *generator) digits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + g.rng.IntN(10))
+	}
+	return string(b)
+}
+
+func (g *generator) base64(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(g.rng.IntN(256))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// ParseTags parses key=value pairs.
+func ParseTags(pairs []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid tag %q, want key=value", pair)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
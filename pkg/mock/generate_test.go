@@ -0,0 +1,156 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+func TestGenerate(t *testing.T) {
+	shape := Shape{
+		InstanceType:     "m6g.xlarge",
+		Region:           "eu-west-1",
+		AvailabilityZone: "eu-west-1b",
+		ENIs:             3,
+		IPv6:             true,
+		Spot:             true,
+		Tags:             map[string]string{"Name": "web-1"},
+		IAMRole:          "my-role",
+		Seed:             7,
+	}
+	tree, err := Generate(shape)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	again, _ := Generate(shape)
+	if !reflect.DeepEqual(tree, again) {
+		t.Error("Generate() is not deterministic for the same seed")
+	}
+
+	md := tree["meta-data"].(map[string]any)
+	doc := tree["dynamic"].(map[string]any)["instance-identity"].(map[string]any)["document"].(map[string]any)
+	macs := md["network"].(map[string]any)["interfaces"].(map[string]any)["macs"].(map[string]any)
+	if len(macs) != 3 {
+		t.Errorf("got %d interfaces, want 3", len(macs))
+	}
+	primary, ok := macs[md["mac"].(string)].(map[string]any)
+	if !ok {
+		t.Fatalf("mac %v is not an interface", md["mac"])
+	}
+	for mac, eni := range macs {
+		if eni.(map[string]any)["mac"] != mac {
+			t.Errorf("interface %s has mac %v", mac, eni.(map[string]any)["mac"])
+		}
+	}
+	checks := map[string][2]any{
+		"primary local-ipv4s":   {primary["local-ipv4s"], md["local-ipv4"]},
+		"primary device-number": {primary["device-number"], "0"},
+		"primary ipv6s":         {primary["ipv6s"], md["ipv6"]},
+		"document privateIp":    {doc["privateIp"], md["local-ipv4"]},
+		"document instanceId":   {doc["instanceId"], md["instance-id"]},
+		"document imageId":      {doc["imageId"], md["ami-id"]},
+		"document az":           {doc["availabilityZone"], "eu-west-1b"},
+		"document architecture": {doc["architecture"], "arm64"},
+		"placement region":      {md["placement"].(map[string]any)["region"], "eu-west-1"},
+		"placement az id":       {md["placement"].(map[string]any)["availability-zone-id"], "euw1-az2"},
+		"instance-life-cycle":   {md["instance-life-cycle"], "spot"},
+		"tags":                  {md["tags"].(map[string]any)["instance"].(map[string]any)["Name"], "web-1"},
+		"owner-id":              {primary["owner-id"], doc["accountId"]},
+		"credentials code":      {md["iam"].(map[string]any)["security-credentials"].(map[string]any)["my-role"].(map[string]any)["Code"], "Success"},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s = %v, want %v", name, c[0], c[1])
+		}
+	}
+	if !strings.HasSuffix(md["hostname"].(string), ".eu-west-1.compute.internal") {
+		t.Errorf("hostname = %v", md["hostname"])
+	}
+
+	// The tree survives a trip through the mock unchanged, so it is in the
+	// shape imds --json produces.
+	ctx := context.Background()
+	server := httptest.NewServer(New(tree, Options{}))
+	defer server.Close()
+	client, err := imds.NewClient(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	got, _ := json.Marshal(client.GetAll(ctx, ""))
+	want, _ := json.Marshal(tree)
+	if string(got) != string(want) {
+		t.Errorf("GetAll() = %s\nwant %s", got, want)
+	}
+}
+
+func TestGenerateUniqueInterfaces(t *testing.T) {
+	for seed := uint64(0); seed < 200; seed++ {
+		tree, err := Generate(Shape{ENIs: 15, Seed: seed})
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		macs := tree["meta-data"].(map[string]any)["network"].(map[string]any)["interfaces"].(map[string]any)["macs"].(map[string]any)
+		if len(macs) != 15 {
+			t.Fatalf("seed %d: got %d interfaces, want 15", seed, len(macs))
+		}
+		ips := map[any]bool{}
+		for _, eni := range macs {
+			ips[eni.(map[string]any)["local-ipv4s"]] = true
+		}
+		if len(ips) != 15 {
+			t.Fatalf("seed %d: got %d distinct private IPs, want 15", seed, len(ips))
+		}
+	}
+}
+
+func TestGenerateAvailabilityZoneID(t *testing.T) {
+	for _, tt := range []struct {
+		region, az, want string
+	}{
+		{"us-east-1", "us-east-1a", "use1-az1"},
+		{"ap-southeast-2", "ap-southeast-2c", "apse2-az3"},
+		{"us-gov-west-1", "us-gov-west-1b", "usgw1-az2"},
+		{"us-gov-east-1", "us-gov-east-1a", "usge1-az1"},
+	} {
+		tree, err := Generate(Shape{Region: tt.region, AvailabilityZone: tt.az})
+		if err != nil {
+			t.Fatalf("Generate(%s) error = %v", tt.az, err)
+		}
+		placement := tree["meta-data"].(map[string]any)["placement"].(map[string]any)
+		if got := placement["availability-zone-id"]; got != tt.want {
+			t.Errorf("Generate(%s) availability-zone-id = %v, want %v", tt.az, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, shape := range []Shape{
+		{InstanceType: "large"},
+		{Region: "mars-1"},
+		{Region: "us-west-2", AvailabilityZone: "us-east-1a"},
+		{ENIs: 16},
+	} {
+		if _, err := Generate(shape); err == nil {
+			t.Errorf("Generate(%+v) succeeded, want error", shape)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwagner5/imds/internal/token"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+const DefaultListen = "127.0.0.1:1338"
+
+// Options configures the fake IMDS.
+type Options struct {
+	// RequireToken rejects requests without a session token, like an instance with IMDSv2 required.
+	RequireToken bool
+	// Faults are injected into responses, see SetFaults.
+	Faults *Faults
+}
+
+// Server is a fake IMDS serving a metadata tree in the shape produced by
+// imds.Client.GetAll and `imds --json`.
+type Server struct {
+	memory *imds.Memory
+	opts   Options
+	tokens *token.Store
+
+	mu        sync.RWMutex
+	faults    *Faults
+	faultHits []int
+}
+
+// New creates a Server for tree. The tree is owned by the Server afterwards
+// and can be changed with Set and Delete.
+func New(tree map[string]any, opts Options) *Server {
+	s := &Server{memory: imds.NewMemory(tree), opts: opts, tokens: token.NewStore(time.Now)}
+	s.SetFaults(opts.Faults)
+	return s
+}
+
+// LoadTree reads a JSON metadata tree, such as the output of `imds --json`.
+func LoadTree(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree := map[string]any{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return tree, nil
+}
+
+// Set replaces the value at path, e.g. "meta-data/spot/instance-action",
+// creating parent directories as needed.
+func (s *Server) Set(path string, value any) {
+	s.memory.Set(path, value)
+}
+
+// Delete removes the value at path.
+func (s *Server) Delete(path string) {
+	s.memory.Delete(path)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, latest := strings.CutPrefix(r.URL.Path, "/latest")
+	path = strings.Trim(path, "/")
+	if s.injectFault(w, r, path) {
+		return
+	}
+	faults := s.Faults()
+	if r.URL.Path == token.Path {
+		if faults.RejectForwarded && r.Header.Get("X-Forwarded-For") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.tokens.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	requireToken := s.opts.RequireToken || faults.RequireToken
+	if t := r.Header.Get(token.Header); (t == "" && requireToken) || (t != "" && !s.tokens.Valid(t)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/" {
+		_, _ = w.Write([]byte("latest"))
+		return
+	}
+	if !latest {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := s.memory.Get(r.Context(), path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write(body)
+}
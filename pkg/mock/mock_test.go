@@ -0,0 +1,121 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+const testTree = `{
+  "dynamic": {
+    "instance-identity": {
+      "document": {"accountId": "123456789012", "region": "us-east-1", "billingProducts": null}
+    }
+  },
+  "meta-data": {
+    "instance-id": "i-1234567890abcdef0",
+    "placement": {"availability-zone": "us-east-1a", "region": "us-east-1"},
+    "security-groups": ["default", "web"],
+    "spot": {"instance-action": {"action": "terminate", "time": "2017-09-18T08:22:00Z"}},
+    "events": {"maintenance": {"scheduled": [{"Code": "system-reboot", "EventId": "instance-event-1"}]}},
+    "tags": {"instance": {"Name": "web-1", "Environment": "prod"}}
+  },
+  "user-data": "#!/bin/bash\necho hello"
+}`
+
+func newTestServer(t *testing.T, opts Options) (*Server, string) {
+	t.Helper()
+	tree := map[string]any{}
+	if err := json.Unmarshal([]byte(testTree), &tree); err != nil {
+		t.Fatalf("parsing test tree: %v", err)
+	}
+	s := New(tree, opts)
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server.URL
+}
+
+func TestGetAllRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	_, url := newTestServer(t, Options{RequireToken: true})
+	client, err := imds.NewClient(ctx, url)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	got, _ := json.Marshal(client.GetAll(ctx, ""))
+	var want any
+	_ = json.Unmarshal([]byte(testTree), &want)
+	wantJSON, _ := json.Marshal(want)
+	if string(got) != string(wantJSON) {
+		t.Errorf("GetAll() = %s\nwant %s", got, wantJSON)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s, url := newTestServer(t, Options{})
+	s.Set("meta-data/events/recommendations/rebalance", `{"noticeTime":"2020-11-05T08:22:00Z"}`)
+	s.Delete("meta-data/spot")
+
+	tests := []struct {
+		path string
+		want string
+		code int
+	}{
+		{"/latest/meta-data/instance-id", "i-1234567890abcdef0", http.StatusOK},
+		{"/latest/meta-data/placement/", "availability-zone\nregion", http.StatusOK},
+		{"/latest/meta-data/security-groups", "default\nweb", http.StatusOK},
+		{"/latest/meta-data/tags/instance", "Environment\nName", http.StatusOK},
+		{"/latest/meta-data/events/recommendations/rebalance", `{"noticeTime":"2020-11-05T08:22:00Z"}`, http.StatusOK},
+		{"/latest/dynamic/instance-identity/document/region", "", http.StatusNotFound},
+		{"/latest/meta-data/spot/instance-action", "", http.StatusNotFound},
+		{"/latest/meta-data/nope", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(url + tt.path)
+			if err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+			defer resp.Body.Close()
+			buf := make([]byte, 4096)
+			n, _ := resp.Body.Read(buf)
+			if resp.StatusCode != tt.code {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.code)
+			}
+			if tt.code == http.StatusOK && string(buf[:n]) != tt.want {
+				t.Errorf("body = %q, want %q", buf[:n], tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	_, url := newTestServer(t, Options{RequireToken: true})
+	resp, err := http.Get(url + "/latest/meta-data/instance-id")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without token = %d, want 401", resp.StatusCode)
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AdminPrefix is where `imds mock` serves the Runner's admin API, outside the
+// /latest tree real IMDS serves.
+const AdminPrefix = "/_admin"
+
+// Scenario is a script of timed changes applied to a Server's tree.
+//
+//	steps:
+//	  - name: interrupt
+//	    at: 30s
+//	    set:
+//	      meta-data/spot/instance-action: {action: terminate, time: "{{now+2m}}"}
+//	  - name: retag
+//	    at: 60s
+//	    set: {meta-data/tags/instance/env: staging}
+//	  - name: rotate
+//	    every: 5m
+//	    rotateCredentials: my-role
+//	  - name: terminate
+//	    set: {meta-data/autoscaling/target-lifecycle-state: Terminated}
+//
+// Steps run once at their offset from the start of the scenario, repeatedly
+// every interval, or, with neither, only when triggered through the admin API.
+type Scenario struct {
+	Steps []Step `yaml:"steps"`
+}
+
+// Step is one change to the tree. String values may contain {{now}} or
+// {{now+<duration>}}, which are replaced with RFC 3339 timestamps when the
+// step runs.
+type Step struct {
+	Name  string         `yaml:"name" json:"name"`
+	At    time.Duration  `yaml:"at" json:"at,omitempty"`
+	Every time.Duration  `yaml:"every" json:"every,omitempty"`
+	Set   map[string]any `yaml:"set" json:"set,omitempty"`
+	// Delete removes paths, e.g. meta-data/spot to clear an interruption.
+	Delete []string `yaml:"delete" json:"delete,omitempty"`
+	// RotateCredentials replaces the IAM credentials of the named role with new ones.
+	RotateCredentials string `yaml:"rotateCredentials" json:"rotateCredentials,omitempty"`
+}
+
+// LoadScenario reads and validates a scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := yaml.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// Validate checks the scenario and fills in default step names.
+func (s *Scenario) Validate() error {
+	names := map[string]bool{}
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step-%d", i)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("duplicate step %q", step.Name)
+		}
+		names[step.Name] = true
+		if step.At < 0 || step.Every < 0 {
+			return fmt.Errorf("step %q: at and every must not be negative", step.Name)
+		}
+		if len(step.Set) == 0 && len(step.Delete) == 0 && step.RotateCredentials == "" {
+			return fmt.Errorf("step %q: one of set, delete or rotateCredentials is required", step.Name)
+		}
+	}
+	return nil
+}
+
+// StepStatus reports a step and how often it has run.
+type StepStatus struct {
+	Step
+	Runs    int        `json:"runs"`
+	LastRun *time.Time `json:"lastRun,omitempty"`
+}
+
+// Runner plays a Scenario against a Server and serves the admin API.
+type Runner struct {
+	server   *Server
+	scenario *Scenario
+	now      func() time.Time
+	mux      *http.ServeMux
+
+	mu     sync.Mutex
+	status map[string]*StepStatus
+}
+
+// NewRunner creates a Runner. A nil scenario serves only the tree endpoints of the admin API.
+func NewRunner(server *Server, scenario *Scenario) *Runner {
+	if scenario == nil {
+		scenario = &Scenario{}
+	}
+	r := &Runner{server: server, scenario: scenario, now: time.Now, status: map[string]*StepStatus{}}
+	for _, step := range scenario.Steps {
+		r.status[step.Name] = &StepStatus{Step: step}
+	}
+	r.mux = r.routes()
+	return r
+}
+
+// Run applies timed steps until ctx is cancelled.
+func (r *Runner) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, step := range r.scenario.Steps {
+		if step.At == 0 && step.Every == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.schedule(ctx, step)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (r *Runner) schedule(ctx context.Context, step Step) {
+	first := step.At
+	if first == 0 {
+		first = step.Every
+	}
+	timer := time.NewTimer(first)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		r.apply(step)
+		if step.Every == 0 {
+			return
+		}
+		timer.Reset(step.Every)
+	}
+}
+
+// Trigger runs the named step immediately.
+func (r *Runner) Trigger(name string) error {
+	for _, step := range r.scenario.Steps {
+		if step.Name == name {
+			r.apply(step)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown step %q", name)
+}
+
+// Steps returns the status of every step in scenario order.
+func (r *Runner) Steps() []StepStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	steps := make([]StepStatus, 0, len(r.scenario.Steps))
+	for _, step := range r.scenario.Steps {
+		steps = append(steps, *r.status[step.Name])
+	}
+	return steps
+}
+
+func (r *Runner) apply(step Step) {
+	now := r.now()
+	for _, path := range step.Delete {
+		r.server.Delete(path)
+	}
+	for path, value := range step.Set {
+		r.server.Set(path, expand(value, now))
+	}
+	if step.RotateCredentials != "" {
+		r.server.Set("meta-data/iam/security-credentials/"+step.RotateCredentials, newCredentials(now))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status[step.Name]
+	status.Runs++
+	status.LastRun = &now
+}
+
+var nowPattern = regexp.MustCompile(`{{\s*now\s*(?:([+-])\s*([0-9a-z.]+))?\s*}}`)
+
+// expand replaces {{now}} and {{now+<duration>}} in string values.
+func expand(value any, now time.Time) any {
+	switch v := value.(type) {
+	case string:
+		return nowPattern.ReplaceAllStringFunc(v, func(match string) string {
+			groups := nowPattern.FindStringSubmatch(match)
+			t := now
+			if groups[2] != "" {
+				d, err := time.ParseDuration(groups[2])
+				if err != nil {
+					return match
+				}
+				if groups[1] == "-" {
+					d = -d
+				}
+				t = now.Add(d)
+			}
+			return t.UTC().Format(time.RFC3339)
+		})
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = expand(item, now)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = expand(item, now)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// newCredentials returns IAM role credentials in the shape IMDS serves,
+// with fresh random keys that expire in six hours.
+func newCredentials(now time.Time) map[string]any {
+	return map[string]any{
+		"Code":            "Success",
+		"LastUpdated":     now.UTC().Format(time.RFC3339),
+		"Type":            "AWS-HMAC",
+		"AccessKeyId":     "ASIA" + strings.ToUpper(randomHex(8)),
+		"SecretAccessKey": randomHex(20),
+		"Token":           randomHex(64),
+		"Expiration":      now.Add(6 * time.Hour).UTC().Format(time.RFC3339),
+	}
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// ServeHTTP serves the admin API:
+//
+//	GET    /steps          list steps and how often they have run
+//	POST   /steps/{name}   run a step now
+//	PUT    /tree/{path}    set a value; JSON bodies are parsed, anything else is stored as a string
+//	DELETE /tree/{path}    delete a value
+//	GET    /faults         show the injected faults
+//	PUT    /faults         replace the injected faults with a YAML or JSON body
+//	DELETE /faults         remove all faults
+func (r *Runner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+func (r *Runner) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /steps", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.Steps())
+	})
+	mux.HandleFunc("POST /steps/{name}", func(w http.ResponseWriter, req *http.Request) {
+		if err := r.Trigger(req.PathValue("name")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("PUT /tree/{path...}", func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var value any
+		if err := json.Unmarshal(body, &value); err != nil {
+			value = string(body)
+		}
+		r.server.Set(req.PathValue("path"), expand(value, r.now()))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /tree/{path...}", func(w http.ResponseWriter, req *http.Request) {
+		r.server.Delete(req.PathValue("path"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /faults", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.server.Faults())
+	})
+	mux.HandleFunc("PUT /faults", func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		faults := &Faults{}
+		if err := yaml.Unmarshal(body, faults); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := faults.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.server.SetFaults(faults)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /faults", func(w http.ResponseWriter, req *http.Request) {
+		r.server.SetFaults(nil)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
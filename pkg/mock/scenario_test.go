@@ -0,0 +1,131 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testScenario = `
+steps:
+  - name: interrupt
+    at: 20ms
+    set:
+      meta-data/spot/instance-action: {action: terminate, time: "{{now+2m}}"}
+  - name: retag
+    set: {meta-data/tags/instance/env: staging}
+    delete: [meta-data/tags/instance/Name]
+  - rotateCredentials: my-role
+`
+
+func loadTestScenario(t *testing.T) *Scenario {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(testScenario), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("LoadScenario() error = %v", err)
+	}
+	return scenario
+}
+
+func get(t *testing.T, s *Server, path string) (string, int) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/latest/"+path, nil))
+	return rec.Body.String(), rec.Code
+}
+
+func TestRunnerTimedStep(t *testing.T) {
+	s, _ := newTestServer(t, Options{})
+	s.Delete("meta-data/spot")
+	runner := NewRunner(s, loadTestScenario(t))
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	runner.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = runner.Run(ctx)
+
+	body, code := get(t, s, "meta-data/spot/instance-action")
+	if code != http.StatusOK {
+		t.Fatalf("instance-action status = %d, want 200", code)
+	}
+	var action map[string]string
+	if err := json.Unmarshal([]byte(body), &action); err != nil {
+		t.Fatalf("decoding instance-action: %v", err)
+	}
+	if action["time"] != "2024-01-01T12:02:00Z" {
+		t.Errorf("instance-action time = %q, want 2024-01-01T12:02:00Z", action["time"])
+	}
+	if steps := runner.Steps(); steps[0].Runs != 1 || steps[1].Runs != 0 {
+		t.Errorf("Steps() = %+v, want only interrupt run once", steps)
+	}
+}
+
+func TestRunnerAdmin(t *testing.T) {
+	s, _ := newTestServer(t, Options{})
+	admin := httptest.NewServer(NewRunner(s, loadTestScenario(t)))
+	t.Cleanup(admin.Close)
+
+	do := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, admin.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := do(http.MethodPost, "/steps/retag", ""); code != http.StatusNoContent {
+		t.Errorf("trigger retag = %d, want 204", code)
+	}
+	if body, _ := get(t, s, "meta-data/tags/instance"); body != "Environment\nenv" {
+		t.Errorf("tags after retag = %q", body)
+	}
+	if code := do(http.MethodPost, "/steps/nope", ""); code != http.StatusNotFound {
+		t.Errorf("trigger unknown step = %d, want 404", code)
+	}
+
+	if code := do(http.MethodPost, "/steps/step-2", ""); code != http.StatusNoContent {
+		t.Errorf("trigger step-2 = %d, want 204", code)
+	}
+	first, _ := get(t, s, "meta-data/iam/security-credentials/my-role")
+	do(http.MethodPost, "/steps/step-2", "")
+	if second, _ := get(t, s, "meta-data/iam/security-credentials/my-role"); first == second || !strings.Contains(second, "AccessKeyId") {
+		t.Errorf("credentials were not rotated: %s", second)
+	}
+
+	do(http.MethodPut, "/tree/meta-data/autoscaling/target-lifecycle-state", "Terminated")
+	if body, _ := get(t, s, "meta-data/autoscaling/target-lifecycle-state"); body != "Terminated" {
+		t.Errorf("target-lifecycle-state = %q, want Terminated", body)
+	}
+	do(http.MethodDelete, "/tree/meta-data/autoscaling", "")
+	if _, code := get(t, s, "meta-data/autoscaling/target-lifecycle-state"); code != http.StatusNotFound {
+		t.Errorf("target-lifecycle-state after delete = %d, want 404", code)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwagner5/imds/internal/token"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+const (
+	TokenPath      = token.Path
+	TokenHeader    = token.Header
+	TokenTTLHeader = token.TTLHeader
+
+	DefaultTTL = 5 * time.Second
+	// DefaultCacheSize is the number of responses cached when Options.CacheSize is zero.
+	DefaultCacheSize = 1024
+)
+
+// DefaultImmutablePaths are cached for the lifetime of the proxy. A path
+// ending in "/" matches everything below it.
+var DefaultImmutablePaths = []string{
+	"meta-data/ami-id",
+	"meta-data/ami-launch-index",
+	"meta-data/ami-manifest-path",
+	"meta-data/instance-id",
+	"meta-data/instance-life-cycle",
+	"meta-data/instance-type",
+	"meta-data/placement/",
+	"meta-data/reservation-id",
+	"dynamic/instance-identity/",
+}
+
+// Options configures caching and token handling.
+type Options struct {
+	// TTL is how long responses for mutable paths are cached. Zero disables caching them.
+	TTL time.Duration
+	// ImmutablePaths are cached indefinitely.
+	ImmutablePaths []string
+	// RequireToken rejects requests without a session token, like an instance with IMDSv2 required.
+	RequireToken bool
+	// CacheSize is the most responses cached, evicting the least recently used.
+	// Zero means DefaultCacheSize.
+	CacheSize int
+}
+
+type entry struct {
+	key     string
+	status  int
+	body    []byte
+	expires time.Time // zero for immutable entries
+}
+
+// Proxy is an IMDS-compatible HTTP handler that issues its own session tokens
+// and serves metadata fetched through an imds.Client, caching responses.
+type Proxy struct {
+	client *imds.Client
+	opts   Options
+	now    func() time.Time
+
+	tokens *token.Store
+
+	mu sync.Mutex
+	// cache indexes the entries in lru, most recently used first.
+	cache map[string]*list.Element
+	lru   *list.List
+}
+
+// New creates a Proxy that fetches metadata with client.
+func New(client *imds.Client, opts Options) *Proxy {
+	if opts.ImmutablePaths == nil {
+		opts.ImmutablePaths = DefaultImmutablePaths
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = DefaultCacheSize
+	}
+	p := &Proxy{
+		client: client,
+		opts:   opts,
+		now:    time.Now,
+		cache:  map[string]*list.Element{},
+		lru:    list.New(),
+	}
+	p.tokens = token.NewStore(func() time.Time { return p.now() })
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == TokenPath {
+		p.tokens.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		_, _ = w.Write([]byte("latest"))
+		return
+	case r.URL.Path == "/latest" || r.URL.Path == "/latest/":
+		_, _ = w.Write([]byte("dynamic\nmeta-data\nuser-data"))
+		return
+	case !strings.HasPrefix(r.URL.Path, "/latest/"):
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/latest/")
+	e := p.fetch(r, path)
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(e.status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(e.body)
+	}
+}
+
+// fetch returns the cached response for path, fetching it through the client when missing or expired.
+func (p *Proxy) fetch(r *http.Request, path string) entry {
+	key := strings.Trim(path, "/")
+	now := p.now()
+	// Unknown categories, such as meta-dataiam, are not IMDS paths and not
+	// cached, so they cannot fill the cache.
+	if !imds.IsMetadataPath(key) {
+		return entry{key: key, status: http.StatusNotFound}
+	}
+	if e, ok := p.cached(key); ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e
+	}
+
+	var e entry
+	resp, err := p.client.Get(r.Context(), key)
+	switch {
+	case err == nil:
+		e = entry{key: key, status: http.StatusOK, body: resp}
+	case errors.Is(err, imds.ErrNotFound):
+		e = entry{key: key, status: http.StatusNotFound}
+	default:
+		// Upstream failures are not cached.
+		return entry{status: http.StatusBadGateway, body: []byte(err.Error())}
+	}
+
+	if !p.immutable(key) || e.status != http.StatusOK {
+		if p.opts.TTL <= 0 {
+			return e
+		}
+		e.expires = now.Add(p.opts.TTL)
+	}
+	p.store(e)
+	return e
+}
+
+// cached returns the cache entry for key, marking it most recently used.
+func (p *Proxy) cached(key string) (entry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	el, ok := p.cache[key]
+	if !ok {
+		return entry{}, false
+	}
+	p.lru.MoveToFront(el)
+	return el.Value.(entry), true
+}
+
+// store caches e, evicting the least recently used entries beyond CacheSize,
+// so that requests for arbitrary paths cannot grow the cache without bound.
+func (p *Proxy) store(e entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.cache[e.key]; ok {
+		el.Value = e
+		p.lru.MoveToFront(el)
+		return
+	}
+	p.cache[e.key] = p.lru.PushFront(e)
+	for p.lru.Len() > p.opts.CacheSize {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.cache, oldest.Value.(entry).key)
+	}
+}
+
+func (p *Proxy) immutable(path string) bool {
+	for _, ip := range p.opts.ImmutablePaths {
+		if path == strings.TrimSuffix(ip, "/") || (strings.HasSuffix(ip, "/") && strings.HasPrefix(path, ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized rejects unknown or expired tokens, and missing tokens when RequireToken is set.
+func (p *Proxy) authorized(r *http.Request) bool {
+	t := r.Header.Get(TokenHeader)
+	if t == "" {
+		return !p.opts.RequireToken
+	}
+	return p.tokens.Valid(t)
+}
@@ -0,0 +1,240 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+var upstreamPaths = map[string]string{
+	"/latest/meta-data":                             "instance-id\nplacement/\nspot/",
+	"/latest/meta-data/instance-id":                 "i-1234567890abcdef0",
+	"/latest/meta-data/placement":                   "availability-zone\nregion",
+	"/latest/meta-data/placement/region":            "us-east-1",
+	"/latest/meta-data/placement/availability-zone": "us-east-1a",
+	"/latest/meta-data/spot":                        "instance-action",
+	"/latest/meta-data/spot/instance-action":        `{"action":"terminate","time":"2017-09-18T08:22:00Z"}`,
+	"/latest/dynamic":                               "instance-identity/",
+	"/latest/dynamic/instance-identity":             "document",
+	"/latest/dynamic/instance-identity/document":    `{"region":"us-east-1"}`,
+	"/latest/user-data":                             "#!/bin/bash",
+}
+
+type upstream struct {
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		w.Header().Set(TokenTTLHeader, "21600")
+		fmt.Fprint(w, "upstream-token")
+		return
+	}
+	u.mu.Lock()
+	u.hits[r.URL.Path]++
+	u.mu.Unlock()
+	if v, ok := upstreamPaths[r.URL.Path]; ok {
+		fmt.Fprint(w, v)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (u *upstream) count(path string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.hits[path]
+}
+
+func newTestProxy(t *testing.T, opts Options) (*Proxy, *upstream, string) {
+	t.Helper()
+	up := &upstream{hits: map[string]int{}}
+	upServer := httptest.NewServer(up)
+	t.Cleanup(upServer.Close)
+	client, err := imds.NewClient(context.Background(), upServer.URL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	p := New(client, opts)
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+	return p, up, server.URL
+}
+
+func TestProxyServesSDKClients(t *testing.T) {
+	ctx := context.Background()
+	_, _, proxyURL := newTestProxy(t, Options{TTL: time.Minute})
+
+	client, err := imds.NewClient(ctx, proxyURL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	got := client.GetAll(ctx, "")
+	want := map[string]any{
+		"meta-data": map[string]any{
+			"instance-id": "i-1234567890abcdef0",
+			"placement":   map[string]any{"region": "us-east-1", "availability-zone": "us-east-1a"},
+			"spot":        map[string]any{"instance-action": map[string]any{"action": "terminate", "time": "2017-09-18T08:22:00Z"}},
+		},
+		"dynamic": map[string]any{
+			"instance-identity": map[string]any{"document": map[string]any{"region": "us-east-1"}},
+		},
+		"user-data": "#!/bin/bash",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll() through proxy = %v, want %v", got, want)
+	}
+}
+
+func TestProxyCaching(t *testing.T) {
+	p, up, proxyURL := newTestProxy(t, Options{TTL: time.Minute})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	get := func(path string) {
+		resp, err := http.Get(proxyURL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	for i := 0; i < 3; i++ {
+		get("/latest/meta-data/instance-id")
+		get("/latest/meta-data/spot/instance-action")
+	}
+	now = now.Add(2 * time.Minute)
+	get("/latest/meta-data/instance-id")
+	get("/latest/meta-data/spot/instance-action")
+
+	if n := up.count("/latest/meta-data/instance-id"); n != 1 {
+		t.Errorf("immutable path fetched %d times, want 1", n)
+	}
+	if n := up.count("/latest/meta-data/spot/instance-action"); n != 2 {
+		t.Errorf("mutable path fetched %d times, want 2", n)
+	}
+}
+
+func TestProxyNotFound(t *testing.T) {
+	_, up, proxyURL := newTestProxy(t, Options{TTL: time.Minute})
+	// The client rejects paths outside meta-data, dynamic and user-data
+	// itself, with an imds.Error not carrying an SDK response.
+	for _, path := range []string{"/latest/meta-data/events/recommendations/rebalance", "/latest/meta-data/events/recommendations/rebalance", "/latest/unknown"} {
+		resp, err := http.Get(proxyURL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+	if n := up.count("/latest/meta-data/events/recommendations/rebalance"); n != 1 {
+		t.Errorf("missing path fetched %d times, want 1", n)
+	}
+}
+
+func TestProxyUnknownCategory(t *testing.T) {
+	p, up, proxyURL := newTestProxy(t, Options{TTL: time.Minute})
+	for _, path := range []string{"/latest/meta-datainstance-id", "/latest/meta-dataiam/security-credentials/my-role", "/latest/dynamicinstance-identity/document", "/latest/user-dataX"} {
+		resp, err := http.Get(proxyURL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+	if n := len(p.cache); n != 0 {
+		t.Errorf("cache holds %d entries, want none", n)
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if len(up.hits) != 0 {
+		t.Errorf("upstream requests %v, want none", up.hits)
+	}
+}
+
+func TestProxyCacheEviction(t *testing.T) {
+	p, up, proxyURL := newTestProxy(t, Options{TTL: time.Minute, CacheSize: 2})
+	for _, path := range []string{"instance-id", "placement/region", "instance-id", "nope-1", "nope-2", "instance-id", "placement/region"} {
+		resp, err := http.Get(proxyURL + "/latest/meta-data/" + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	if n := len(p.cache); n != 2 || p.lru.Len() != 2 {
+		t.Errorf("cache holds %d entries (%d in LRU), want 2", n, p.lru.Len())
+	}
+	// instance-id was used more recently than placement/region when nope-1
+	// arrived, so it stayed cached until nope-2 evicted it.
+	if n := up.count("/latest/meta-data/instance-id"); n != 2 {
+		t.Errorf("instance-id fetched %d times, want 2", n)
+	}
+	if n := up.count("/latest/meta-data/placement/region"); n != 2 {
+		t.Errorf("placement/region fetched %d times, want 2", n)
+	}
+}
+
+func TestProxyTokens(t *testing.T) {
+	_, _, proxyURL := newTestProxy(t, Options{RequireToken: true})
+
+	do := func(method, path string, header map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, proxyURL+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do(http.MethodPut, TokenPath, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT without TTL = %d, want 400", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/latest/meta-data/instance-id", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without token = %d, want 401", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/latest/meta-data/instance-id", map[string]string{TokenHeader: "bogus"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET with unknown token = %d, want 401", resp.StatusCode)
+	}
+
+	resp := do(http.MethodPut, TokenPath, map[string]string{TokenTTLHeader: "60"})
+	token, _ := io.ReadAll(resp.Body)
+	resp = do(http.MethodGet, "/latest/meta-data/instance-id", map[string]string{TokenHeader: string(token)})
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "i-1234567890abcdef0" {
+		t.Errorf("GET with token = %d %q, want 200 instance id", resp.StatusCode, body)
+	}
+	if resp := do(http.MethodGet, "/latest/meta-data/nope", map[string]string{TokenHeader: string(token)}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET missing key = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package query selects values from the metadata tree with jq-style path
+// expressions, such as network.interfaces.macs.*.vpc-id or
+// dynamic.instance-identity.document.accountId.
+//
+// An expression is a dot-separated list of keys, optionally starting with a
+// dot. * matches every key of a directory or item of a list, [N] picks a list
+// item, counting from the end if negative, and [*] every item. Keys holding
+// dots or brackets, such as public IP addresses, can be quoted as "3.1.2.4"
+// or ["3.1.2.4"]. Expressions reach into JSON documents, and start below
+// meta-data unless the first key is meta-data, dynamic or user-data.
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepWildcard
+	stepIndex
+)
+
+type step struct {
+	kind  stepKind
+	key   string
+	index int
+}
+
+// Query is a parsed expression.
+type Query struct {
+	expr  string
+	steps []step
+}
+
+// Parse parses a query expression.
+func Parse(expr string) (*Query, error) {
+	q := &Query{expr: expr}
+	s := strings.TrimPrefix(strings.TrimSpace(expr), ".")
+	if s == "" {
+		return nil, fmt.Errorf("parsing query %q: empty expression", expr)
+	}
+	// Each key is preceded by a dot, except the first.
+	expectKey := true
+	for s != "" {
+		switch {
+		case s[0] == '[':
+			end := closingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("parsing query %q: unterminated [", expr)
+			}
+			st, err := parseIndex(s[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("parsing query %q: %w", expr, err)
+			}
+			q.steps = append(q.steps, st)
+			s = s[end+1:]
+			expectKey = false
+		case s[0] == '.' && !expectKey:
+			s = s[1:]
+			expectKey = true
+		case expectKey:
+			key, rest, err := parseKey(s)
+			if err != nil {
+				return nil, fmt.Errorf("parsing query %q: %w", expr, err)
+			}
+			if key == "*" {
+				q.steps = append(q.steps, step{kind: stepWildcard})
+			} else {
+				q.steps = append(q.steps, step{kind: stepKey, key: key})
+			}
+			s = rest
+			expectKey = false
+		default:
+			return nil, fmt.Errorf("parsing query %q: unexpected %q", expr, s)
+		}
+	}
+	if expectKey {
+		return nil, fmt.Errorf("parsing query %q: missing key after .", expr)
+	}
+
+	switch first := q.steps[0]; {
+	case first.kind == stepKey && (first.key == "meta-data" || first.key == "dynamic" || first.key == "user-data"):
+	default:
+		q.steps = append([]step{{kind: stepKey, key: "meta-data"}}, q.steps...)
+	}
+	return q, nil
+}
+
+// closingBracket returns the index of the ] closing the [ that s starts
+// with, skipping quoted strings, or -1.
+func closingBracket(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ']' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+func parseIndex(s string) (step, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "*":
+		return step{kind: stepWildcard}, nil
+	case strings.HasPrefix(s, `"`):
+		key, err := strconv.Unquote(s)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid quoted key %s", s)
+		}
+		return step{kind: stepKey, key: key}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return step{}, fmt.Errorf("invalid index [%s]", s)
+	}
+	return step{kind: stepIndex, index: n}, nil
+}
+
+// parseKey reads a plain or quoted key from the start of s.
+func parseKey(s string) (string, string, error) {
+	if s[0] == '"' {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				key, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid quoted key %s", s[:i+1])
+				}
+				return key, s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated quoted key %s", s)
+	}
+	end := strings.IndexAny(s, ".[]\"")
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("unexpected %q", s)
+	}
+	return s[:end], s[end:], nil
+}
+
+// String returns the expression q was parsed from.
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Prefix returns the path of the directory or value the query starts with,
+// before any wildcard or index, such as meta-data/network/interfaces/macs.
+// Only the tree below it is needed to evaluate the query.
+func (q *Query) Prefix() string {
+	var keys []string
+	for _, st := range q.steps {
+		if st.kind != stepKey {
+			break
+		}
+		keys = append(keys, st.key)
+	}
+	return strings.Join(keys, "/")
+}
+
+// Eval returns the values the query selects in tree, a metadata tree as
+// returned by imds.Backend.GetAll, in tree order and in their JSON form, so
+// lists are []any whichever backend the tree came from. Strings holding JSON
+// documents are decoded when the query reaches into them.
+func (q *Query) Eval(tree map[string]any) []any {
+	values := []any{imds.Normalize(tree)}
+	for _, st := range q.steps {
+		var next []any
+		for _, v := range values {
+			next = append(next, apply(st, v)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func apply(st step, v any) []any {
+	if s, ok := v.(string); ok {
+		var doc any
+		_ = json.Unmarshal([]byte(s), &doc)
+		switch doc.(type) {
+		case map[string]any, []any:
+			v = doc
+		default:
+			// IMDS serves a list with one item, such as the security
+			// groups of an instance with only one, as a plain value.
+			v = []any{s}
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		switch st.kind {
+		case stepKey:
+			if child, ok := v[st.key]; ok {
+				return []any{child}
+			}
+		case stepWildcard:
+			values := make([]any, 0, len(v))
+			for _, k := range imds.SortedKeys(v) {
+				values = append(values, v[k])
+			}
+			return values
+		}
+	case []any:
+		switch st.kind {
+		case stepIndex:
+			i := st.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return []any{v[i]}
+			}
+		case stepWildcard:
+			return v
+		}
+	}
+	return nil
+}
+
+// Run reads the tree the query needs with getAll and returns the values it
+// selects. If nothing exists at the prefix, such as for a key inside a JSON
+// document that cannot be read on its own, it reads the parent instead.
+func (q *Query) Run(ctx context.Context, getAll func(ctx context.Context, path string) (map[string]any, error)) ([]any, error) {
+	path := q.Prefix()
+	for {
+		tree, err := getAll(ctx, path)
+		if len(tree) > 0 || err != nil || !strings.Contains(path, "/") {
+			return q.Eval(tree), err
+		}
+		path = path[:strings.LastIndex(path, "/")]
+	}
+}
+
+// Select parses expr, reads the tree below its prefix from b and returns the
+// values it selects.
+func Select(ctx context.Context, b imds.Backend, expr string) ([]any, error) {
+	q, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return q.Run(ctx, func(ctx context.Context, path string) (map[string]any, error) {
+		return b.GetAll(ctx, path), nil
+	})
+}
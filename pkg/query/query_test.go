@@ -0,0 +1,163 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+var tree = map[string]any{
+	"meta-data": map[string]any{
+		"instance-id": "i-1234567890abcdef0",
+		"network": map[string]any{
+			"interfaces": map[string]any{
+				"macs": map[string]any{
+					"0e:00:00:00:00:02": map[string]any{"vpc-id": "vpc-2", "device-number": "1"},
+					"0e:00:00:00:00:01": map[string]any{
+						"vpc-id":            "vpc-1",
+						"device-number":     "0",
+						"ipv4-associations": map[string]any{"3.1.2.4": "10.0.0.4"},
+					},
+				},
+			},
+		},
+		"security-groups": []any{"default", "web"},
+		"events": map[string]any{
+			"maintenance": map[string]any{
+				"scheduled": `[{"Code":"system-reboot","State":"active"}]`,
+			},
+		},
+	},
+	"dynamic": map[string]any{
+		"instance-identity": map[string]any{
+			"document": map[string]any{"accountId": "123456789012", "region": "us-east-1"},
+		},
+	},
+	"user-data": "#!/bin/bash",
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []any
+	}{
+		{"instance-id", []any{"i-1234567890abcdef0"}},
+		{".meta-data.instance-id", []any{"i-1234567890abcdef0"}},
+		{"dynamic.instance-identity.document.accountId", []any{"123456789012"}},
+		{"network.interfaces.macs.*.vpc-id", []any{"vpc-1", "vpc-2"}},
+		{`network.interfaces.macs["0e:00:00:00:00:02"].device-number`, []any{"1"}},
+		{`network.interfaces.macs.*.ipv4-associations."3.1.2.4"`, []any{"10.0.0.4"}},
+		{"security-groups[1]", []any{"web"}},
+		{"security-groups[-1]", []any{"web"}},
+		{"security-groups[*]", []any{"default", "web"}},
+		{"security-groups[2]", nil},
+		{"events.maintenance.scheduled[0].Code", []any{"system-reboot"}},
+		{"events.maintenance.scheduled.*.State", []any{"active"}},
+		{"instance-id[0]", []any{"i-1234567890abcdef0"}},
+		{"instance-id[-1]", []any{"i-1234567890abcdef0"}},
+		{"instance-id[1]", nil},
+		{"user-data", []any{"#!/bin/bash"}},
+		{"missing.key", nil},
+		{"instance-id.foo", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := q.Eval(tree); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalClientLists(t *testing.T) {
+	// imds.Client.GetAll stores newline-separated values as []string.
+	tree := map[string]any{"meta-data": map[string]any{
+		"security-groups": []string{"default", "web"},
+	}}
+	tests := []struct {
+		expr string
+		want []any
+	}{
+		{"security-groups[1]", []any{"web"}},
+		{"security-groups.*", []any{"default", "web"}},
+		{"security-groups", []any{[]any{"default", "web"}}},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+		}
+		if got := q.Eval(tree); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", ".", "network.", "network..macs", "macs[", "macs[x]", `macs."unterminated`, "macs]"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", expr)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := map[string]string{
+		"network.interfaces.macs.*.vpc-id":             "meta-data/network/interfaces/macs",
+		"dynamic.instance-identity.document.accountId": "dynamic/instance-identity/document/accountId",
+		"security-groups[0]":                           "meta-data/security-groups",
+		"*":                                            "meta-data",
+	}
+	for expr, want := range tests {
+		q, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", expr, err)
+		}
+		if got := q.Prefix(); got != want {
+			t.Errorf("Parse(%q).Prefix() = %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	memory := imds.NewMemory(tree)
+	memory.Set("dynamic/instance-identity/document", `{"accountId": "123456789012"}`)
+	tests := map[string][]any{
+		"network.interfaces.macs.*.vpc-id":             {"vpc-1", "vpc-2"},
+		"dynamic.instance-identity.document.accountId": {"123456789012"},
+		"network.missing":                              nil,
+	}
+	for expr, want := range tests {
+		got, err := Select(context.Background(), memory, expr)
+		if err != nil {
+			t.Fatalf("Select(%q) error = %v", expr, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Select(%q) = %v, want %v", expr, got, want)
+		}
+	}
+	if _, err := Select(context.Background(), imds.NewMemory(tree), "macs["); err == nil || !strings.Contains(err.Error(), "unterminated") {
+		t.Errorf("Select() error = %v, want unterminated", err)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render executes Go templates against the IMDS metadata tree, to
+// generate config files from instance metadata.
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net/netip"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Render reads the whole metadata tree from b and executes the template
+// text against it.
+func Render(ctx context.Context, b imds.Backend, name, text string) ([]byte, error) {
+	return Execute(b.GetAll(ctx, ""), name, text)
+}
+
+// Execute executes the template text against tree, a metadata tree as
+// returned by imds.Backend.GetAll, with Funcs available. The tree is the
+// template's data in its JSON form, so {{ index . "meta-data" "instance-id" }}
+// is the instance ID and lists are []any whichever backend it came from.
+func Execute(tree map[string]any, name, text string) ([]byte, error) {
+	tree = imds.Normalize(tree)
+	tmpl, err := template.New(name).Funcs(Funcs(tree)).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Funcs returns the template functions for tree, where missing values are
+// empty strings:
+//
+//	key "region"                 value of a key found by name, as by imds.FindKey
+//	get "placement/region"       value at a path
+//	default "none" (key "ipv6")  the value, or the default if it is empty
+//	required "msg" value         the value, or an error with msg if it is empty
+//	document                     the instance identity document
+//	fromJSON "{...}"             a decoded JSON document
+//	toJSON value                 value encoded as JSON
+//	tag "Name"                   an instance tag, if tags are in metadata
+//	tags                         all instance tags
+//	join "," list                list joined with a separator
+//	cidrHost "10.0.0.0/16" 5     the 5th address in a prefix: 10.0.0.5
+//	cidrNetmask "10.0.0.0/16"    the prefix's netmask: 255.255.0.0
+//	cidrContains "10.0.0.0/8" ip whether the prefix contains an address
+//	cidrSubnet "10.0.0.0/16" 8 2 the 2nd /24 in the prefix: 10.0.2.0/24
+func Funcs(tree map[string]any) template.FuncMap {
+	memory := imds.NewMemory(tree)
+	get := func(path string) any {
+		if v := valueAt(tree, imds.NormalizePath(path)); v != nil {
+			return v
+		}
+		return ""
+	}
+	return template.FuncMap{
+		"key": func(name string) (any, error) {
+			paths := imds.FindKeys(context.Background(), memory, name)
+			switch len(paths) {
+			case 0:
+				return "", nil
+			case 1:
+				return valueAt(tree, paths[0]), nil
+			}
+			return nil, fmt.Errorf("key %q is ambiguous, use get with one of %s", name, strings.Join(paths, ", "))
+		},
+		"get": get,
+		"default": func(def, value any) any {
+			if empty(value) {
+				return def
+			}
+			return value
+		},
+		"required": func(msg string, value any) (any, error) {
+			if empty(value) {
+				return nil, errors.New(msg)
+			}
+			return value, nil
+		},
+		"document": func() any {
+			return get("dynamic/instance-identity/document")
+		},
+		"fromJSON": func(s string) (any, error) {
+			var v any
+			err := json.Unmarshal([]byte(s), &v)
+			return v, err
+		},
+		"toJSON": func(v any) (string, error) {
+			data, err := imds.MarshalIndent(v, "", "")
+			if err != nil {
+				return "", err
+			}
+			var buf bytes.Buffer
+			err = json.Compact(&buf, data)
+			return buf.String(), err
+		},
+		"tag": func(name string) any {
+			return get("meta-data/tags/instance/" + name)
+		},
+		"tags": func() map[string]any {
+			tags, _ := get("meta-data/tags/instance").(map[string]any)
+			return tags
+		},
+		"join": func(sep string, v any) string {
+			switch v := v.(type) {
+			case nil:
+				return ""
+			case []any:
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				return strings.Join(items, sep)
+			case []string:
+				return strings.Join(v, sep)
+			}
+			return fmt.Sprint(v)
+		},
+		"cidrHost":     cidrHost,
+		"cidrNetmask":  cidrNetmask,
+		"cidrContains": cidrContains,
+		"cidrSubnet":   cidrSubnet,
+	}
+}
+
+// valueAt returns the value at path in tree, or nil.
+func valueAt(tree map[string]any, path string) any {
+	var v any = tree
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[segment]
+	}
+	return v
+}
+
+func empty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func cidrHost(prefix string, n int) (string, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	addr, err := offset(p.Masked().Addr(), big.NewInt(int64(n)))
+	if err != nil || n < 0 || !p.Contains(addr) {
+		return "", fmt.Errorf("host %d is outside %s", n, prefix)
+	}
+	return addr.String(), nil
+}
+
+func cidrNetmask(prefix string) (string, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if !p.Addr().Is4() {
+		return "", fmt.Errorf("%s is not an IPv4 prefix", prefix)
+	}
+	mask := ^uint32(0) << (32 - p.Bits())
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], mask)
+	return netip.AddrFrom4(b).String(), nil
+}
+
+func cidrContains(prefix, addr string) (bool, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return false, err
+	}
+	a, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false, err
+	}
+	return p.Contains(a), nil
+}
+
+// cidrSubnet returns subnet num of prefix extended by bits, as Terraform's
+// cidrsubnet does.
+func cidrSubnet(prefix string, bits, num int) (string, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	size := p.Bits() + bits
+	if bits < 0 || num < 0 || size > p.Addr().BitLen() || big.NewInt(int64(num)).BitLen() > bits {
+		return "", fmt.Errorf("subnet %d of %d bits does not fit in %s", num, bits, prefix)
+	}
+	n := new(big.Int).Lsh(big.NewInt(int64(num)), uint(p.Addr().BitLen()-size))
+	addr, err := offset(p.Masked().Addr(), n)
+	if err != nil {
+		return "", err
+	}
+	return netip.PrefixFrom(addr, size).String(), nil
+}
+
+// offset adds n to addr.
+func offset(addr netip.Addr, n *big.Int) (netip.Addr, error) {
+	sum := new(big.Int).Add(new(big.Int).SetBytes(addr.AsSlice()), n)
+	if sum.BitLen() > addr.BitLen() {
+		return netip.Addr{}, fmt.Errorf("%s + %s overflows", addr, n)
+	}
+	result, _ := netip.AddrFromSlice(sum.FillBytes(make([]byte, addr.BitLen()/8)))
+	return result, nil
+}
+
+// WriteFile atomically replaces the file at path with data, unless it already
+// holds data, and reports whether it was written. A new file gets perm; an
+// existing one keeps its permissions.
+func WriteFile(path string, data []byte, perm fs.FileMode) (bool, error) {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+			os.Remove(tmp)
+			return false, err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,122 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testTree() map[string]any {
+	return map[string]any{
+		"meta-data": map[string]any{
+			"instance-id":     "i-1234567890abcdef0",
+			"mac":             "0e:00:00:00:00:01",
+			"placement":       map[string]any{"region": "us-east-1", "availability-zone": "us-east-1a"},
+			"security-groups": []any{"web", "ssh"},
+			"tags":            map[string]any{"instance": map[string]any{"Name": "web-1"}},
+			"network": map[string]any{"interfaces": map[string]any{"macs": map[string]any{
+				"0e:00:00:00:00:01": map[string]any{"mac": "0e:00:00:00:00:01", "vpc-ipv4-cidr-block": "10.0.0.0/16"},
+				"0e:00:00:00:00:02": map[string]any{"mac": "0e:00:00:00:00:02", "vpc-ipv4-cidr-block": "10.0.0.0/16"},
+			}}},
+		},
+		"dynamic": map[string]any{"instance-identity": map[string]any{
+			"document": map[string]any{"accountId": "123456789012", "region": "us-east-1"},
+		}},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name, text, want, wantErr string
+	}{
+		{name: "data", text: `{{ index . "meta-data" "instance-id" }}`, want: "i-1234567890abcdef0"},
+		{name: "key", text: `{{ key "region" }}/{{ key "availability-zone" }}`, want: "us-east-1/us-east-1a"},
+		{name: "get", text: `{{ get "placement/region" }}`, want: "us-east-1"},
+		{name: "default", text: `{{ key "ipv6" | default "none" }} {{ key "region" | default "none" }}`, want: "none us-east-1"},
+		{name: "required", text: `{{ key "ipv6" | required "ipv6 is not assigned" }}`, wantErr: "ipv6 is not assigned"},
+		{name: "ambiguous", text: `{{ key "mac" }}`, wantErr: "ambiguous"},
+		{name: "document", text: `{{ (document).accountId }}`, want: "123456789012"},
+		{name: "fromJSON", text: `{{ (fromJSON "{\"Code\": \"system-reboot\"}").Code }}`, want: "system-reboot"},
+		{name: "toJSON", text: `{{ toJSON (get "placement") }}`, want: `{"availability-zone":"us-east-1a","region":"us-east-1"}`},
+		{name: "tags", text: `{{ tag "Name" }}{{ range $k, $v := tags }} {{ $k }}={{ $v }}{{ end }}`, want: "web-1 Name=web-1"},
+		{name: "join", text: `{{ join "," (get "meta-data/security-groups") }}`, want: "web,ssh"},
+		{name: "primary vpc", text: `{{ cidrHost (get (printf "network/interfaces/macs/%s/vpc-ipv4-cidr-block" (get "mac"))) 2 }}`, want: "10.0.0.2"},
+		{name: "cidrHost", text: `{{ cidrHost "10.0.0.0/16" 2 }} {{ cidrHost "10.0.0.0/24" 256 }}`, wantErr: "outside"},
+		{name: "cidr", text: `{{ $vpc := get "network/interfaces/macs/0e:00:00:00:00:01/vpc-ipv4-cidr-block" }}{{ cidrHost $vpc 2 }} {{ cidrNetmask $vpc }} {{ cidrContains $vpc "10.0.3.4" }} {{ cidrSubnet $vpc 8 3 }}`, want: "10.0.0.2 255.255.0.0 true 10.0.3.0/24"},
+		{name: "cidr ipv6", text: `{{ cidrHost "2600:1f18::/56" 257 }} {{ cidrSubnet "2600:1f18::/56" 8 1 }}`, want: "2600:1f18::101 2600:1f18:0:1::/64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Execute(testTree(), tt.name, tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Execute() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteClientLists(t *testing.T) {
+	// imds.Client.GetAll stores newline-separated values as []string.
+	tree := map[string]any{"meta-data": map[string]any{
+		"security-groups": []string{"web", "ssh"},
+		"ipv6s":           []string{},
+	}}
+	text := `{{ join "," (get "security-groups") }}|{{ range get "security-groups" }}{{ . }};{{ end }}|{{ get "ipv6s" | default "none" }}`
+	got, err := Execute(tree, "lists", text)
+	if want := "web,ssh|web;ssh;|none"; err != nil || string(got) != want {
+		t.Errorf("Execute() = %q, %v, want %q", got, err, want)
+	}
+
+	funcs := Funcs(tree)
+	join := funcs["join"].(func(string, any) string)
+	if got := join(",", []string{"web", "ssh"}); got != "web,ssh" {
+		t.Errorf("join() = %q, want web,ssh", got)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.conf")
+	if changed, err := WriteFile(path, []byte("a"), 0o640); err != nil || !changed {
+		t.Fatalf("WriteFile() new = %v, %v", changed, err)
+	}
+	if changed, err := WriteFile(path, []byte("a"), 0o600); err != nil || changed {
+		t.Errorf("WriteFile() unchanged = %v, %v", changed, err)
+	}
+	if err := os.Chmod(path, 0o604); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := WriteFile(path, []byte("b"), 0o600); err != nil || !changed {
+		t.Errorf("WriteFile() changed = %v, %v", changed, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o604 {
+		t.Errorf("mode = %v, %v, want the existing 0604", info.Mode(), err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "b" {
+		t.Errorf("content = %q", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
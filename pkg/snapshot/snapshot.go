@@ -0,0 +1,337 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snapshot captures the raw IMDS tree to a file and reads it back as
+// an offline data source.
+package snapshot
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwagner5/imds/internal/glob"
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+// Version is the snapshot format version written by Capture.
+const Version = 1
+
+// RedactedBody replaces the body of redacted entries.
+const RedactedBody = "REDACTED"
+
+// ErrNotSnapshot is returned by Parse and Load for JSON that is not a snapshot.
+var ErrNotSnapshot = errors.New("not an imds snapshot")
+
+// DefaultRedact are the paths redacted unless disabled: the IAM and identity credentials.
+var DefaultRedact = []string{
+	"meta-data/iam/security-credentials/*",
+	"meta-data/identity-credentials/ec2/security-credentials/*",
+}
+
+// Snapshot is the raw IMDS tree at one point in time.
+type Snapshot struct {
+	Version     int       `json:"version"`
+	CapturedAt  time.Time `json:"capturedAt"`
+	Endpoint    string    `json:"endpoint,omitempty"`
+	ToolVersion string    `json:"toolVersion,omitempty"`
+	// Redacted lists the paths whose bodies were replaced with RedactedBody.
+	Redacted []string `json:"redacted,omitempty"`
+	// Entries holds every path fetched, sorted by path.
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is the response to one IMDS request.
+type Entry struct {
+	Path string `json:"path"`
+	// Directory is set for listings, whose bodies name the children.
+	Directory bool `json:"directory,omitempty"`
+	// Status is the HTTP status code, or zero if the request failed without a response.
+	Status int    `json:"status"`
+	Body   string `json:"body,omitempty"`
+	// Encoding is "base64" when the body is not valid UTF-8.
+	Encoding string `json:"encoding,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Options configures Capture.
+type Options struct {
+	// Path limits the capture to a subtree, e.g. "meta-data/placement".
+	Path string
+	// Endpoint and ToolVersion are recorded in the snapshot.
+	Endpoint    string
+	ToolVersion string
+	// Redact are globs of paths whose bodies are not recorded, where "*"
+	// matches within one segment and "**" matches any number of segments.
+	Redact []string
+}
+
+// Capture walks the IMDS tree below opts.Path and records every response.
+func Capture(ctx context.Context, client *imds.Client, opts Options) (*Snapshot, error) {
+	snap := &Snapshot{
+		Version:     Version,
+		CapturedAt:  time.Now().UTC(),
+		Endpoint:    opts.Endpoint,
+		ToolVersion: opts.ToolVersion,
+	}
+
+	type item struct {
+		path string
+		dir  bool
+	}
+	var queue []item
+	if path := strings.Trim(opts.Path, "/"); path != "" {
+		queue = []item{{path: path, dir: strings.HasSuffix(opts.Path, "/") || isDirectory(ctx, client, path)}}
+	} else {
+		queue = []item{{path: "dynamic", dir: true}, {path: "meta-data", dir: true}, {path: "user-data"}}
+	}
+
+	captured := false
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry := Entry{Path: cur.path, Directory: cur.dir}
+		resp, err := client.Get(ctx, cur.path)
+		if err != nil {
+			entry.Status = statusCode(err)
+			entry.Error = err.Error()
+			snap.Entries = append(snap.Entries, entry)
+			continue
+		}
+		captured = true
+		entry.Status = http.StatusOK
+		if cur.dir {
+			for _, line := range strings.Split(strings.Trim(string(resp), "\n"), "\n") {
+				if line != "" {
+					queue = append(queue, item{path: cur.path + "/" + strings.TrimSuffix(line, "/"), dir: strings.HasSuffix(line, "/")})
+				}
+			}
+		}
+		if matchAny(opts.Redact, cur.path) && !cur.dir {
+			resp = []byte(RedactedBody)
+			snap.Redacted = append(snap.Redacted, cur.path)
+		}
+		entry.setBody(resp)
+		snap.Entries = append(snap.Entries, entry)
+	}
+	if !captured {
+		return nil, fmt.Errorf("no metadata captured from %s", opts.Endpoint)
+	}
+
+	sort.Slice(snap.Entries, func(i, j int) bool { return snap.Entries[i].Path < snap.Entries[j].Path })
+	sort.Strings(snap.Redacted)
+	return snap, nil
+}
+
+// isDirectory reports whether the listing of path's parent names it as a
+// directory, as IMDS marks directories with a trailing "/" there.
+func isDirectory(ctx context.Context, client *imds.Client, path string) bool {
+	parent, name := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		parent, name = path[:i], path[i+1:]
+	}
+	resp, err := client.Get(ctx, parent)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(resp), "\n") {
+		if strings.TrimSpace(line) == name+"/" {
+			return true
+		}
+	}
+	return false
+}
+
+// statusCode returns the HTTP status code of a failed IMDS request, or zero
+// if no response was received.
+func statusCode(err error) int {
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+func matchAny(globs []string, path string) bool {
+	for _, g := range globs {
+		if glob.Match(g, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Entry) setBody(body []byte) {
+	if utf8.Valid(body) {
+		e.Body = string(body)
+		return
+	}
+	e.Body = base64.StdEncoding.EncodeToString(body)
+	e.Encoding = "base64"
+}
+
+// Bytes returns the raw response body.
+func (e *Entry) Bytes() ([]byte, error) {
+	if e.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(e.Body)
+	}
+	return []byte(e.Body), nil
+}
+
+// Load reads a snapshot file.
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// Parse decodes a snapshot.
+func Parse(data []byte) (*Snapshot, error) {
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, ErrNotSnapshot
+		}
+		return nil, err
+	}
+	if snap.Version == 0 || snap.Entries == nil {
+		return nil, ErrNotSnapshot
+	}
+	if snap.Version > Version {
+		return nil, fmt.Errorf("unsupported snapshot version %d, this version of imds reads up to %d", snap.Version, Version)
+	}
+	sort.Slice(snap.Entries, func(i, j int) bool { return snap.Entries[i].Path < snap.Entries[j].Path })
+	return snap, nil
+}
+
+// Encode writes the snapshot as indented JSON.
+func (s *Snapshot) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Entry returns the entry recorded for path.
+func (s *Snapshot) Entry(path string) (*Entry, bool) {
+	path = strings.Trim(path, "/")
+	i := sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].Path >= path })
+	if i < len(s.Entries) && s.Entries[i].Path == path {
+		return &s.Entries[i], true
+	}
+	return nil, false
+}
+
+var _ imds.Backend = (*Snapshot)(nil)
+
+// Get returns the raw body recorded for path, like imds.Client.Get.
+func (s *Snapshot) Get(_ context.Context, path string) ([]byte, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []byte("meta-data/\ndynamic/\nuser-data"), nil
+	}
+	e, ok := s.Entry(path)
+	switch {
+	case !ok:
+		return nil, imds.NewError(path, http.StatusNotFound, nil)
+	case e.Status != http.StatusOK:
+		return nil, imds.NewError(path, e.Status, fmt.Errorf("captured: %s", e.Error))
+	}
+	return e.Bytes()
+}
+
+// List returns the names recorded in the directory at path.
+func (s *Snapshot) List(ctx context.Context, path string) ([]string, error) {
+	resp, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(strings.Trim(string(resp), "\n"), "\n") {
+		if line != "" {
+			names = append(names, line)
+		}
+	}
+	imds.SortListing(names)
+	return names, nil
+}
+
+// Watch sends the tree below path once; a snapshot never changes.
+func (s *Snapshot) Watch(ctx context.Context, path string) <-chan map[string]any {
+	return imds.Poll(ctx, s, path, imds.WatchInterval)
+}
+
+// GetAll returns the tree below path in the shape of imds.Client.GetAll.
+func (s *Snapshot) GetAll(_ context.Context, path string) map[string]any {
+	path = strings.Trim(path, "/")
+	result := map[string]any{}
+	failed := map[string]bool{}
+	for _, e := range s.Entries {
+		if e.Status != http.StatusOK {
+			if i := strings.LastIndex(e.Path, "/"); i > 0 {
+				failed[e.Path[:i]] = true
+			}
+		}
+	}
+	// Like GetAll, a directory with a child that could not be fetched is kept
+	// as a value, replacing what was found below it.
+	var dirs []Entry
+	for _, e := range s.Entries {
+		if e.Status != http.StatusOK || (path != "" && e.Path != path && !strings.HasPrefix(e.Path, path+"/")) {
+			continue
+		}
+		if e.Directory {
+			if failed[e.Path] {
+				dirs = append(dirs, e)
+			}
+			continue
+		}
+		setValue(result, e)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		setValue(result, dirs[i])
+	}
+	return result
+}
+
+func setValue(tree map[string]any, e Entry) {
+	body, err := e.Bytes()
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(e.Path, "user-data") {
+		tree["user-data"] = string(body)
+		return
+	}
+	imds.SetValueAt(tree, e.Path, body)
+}
@@ -0,0 +1,150 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+const testTree = `{
+  "dynamic": {
+    "instance-identity": {
+      "document": {"accountId": "123456789012", "region": "us-east-1"}
+    }
+  },
+  "meta-data": {
+    "instance-id": "i-1234567890abcdef0",
+    "iam": {"security-credentials": {"my-role": {"AccessKeyId": "ASIAEXAMPLE", "Code": "Success"}}},
+    "placement": {"availability-zone": "us-east-1a", "region": "us-east-1"},
+    "security-groups": ["default", "web"]
+  },
+  "user-data": "#!/bin/bash\necho hello"
+}`
+
+func capture(t *testing.T, tree string, opts Options) *Snapshot {
+	t.Helper()
+	ctx := context.Background()
+	m := map[string]any{}
+	if err := json.Unmarshal([]byte(tree), &m); err != nil {
+		t.Fatalf("parsing test tree: %v", err)
+	}
+	server := httptest.NewServer(mock.New(m, mock.Options{}))
+	t.Cleanup(server.Close)
+	client, err := imds.NewClient(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	opts.Endpoint = server.URL
+	snap, err := Capture(ctx, client, opts)
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	return snap
+}
+
+func TestCaptureRoundTrip(t *testing.T) {
+	snap := capture(t, testTree, Options{})
+	var buf bytes.Buffer
+	if err := snap.Encode(&buf); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	loaded, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got, _ := json.Marshal(loaded.GetAll(context.Background(), ""))
+	var want any
+	_ = json.Unmarshal([]byte(testTree), &want)
+	wantJSON, _ := json.Marshal(want)
+	if string(got) != string(wantJSON) {
+		t.Errorf("GetAll() = %s\nwant %s", got, wantJSON)
+	}
+
+	if body, err := loaded.Get(context.Background(), "meta-data/security-groups"); err != nil || string(body) != "default\nweb" {
+		t.Errorf("Get(security-groups) = %q, %v", body, err)
+	}
+	if e, ok := loaded.Entry("meta-data/placement"); !ok || !e.Directory || e.Body != "availability-zone\nregion" {
+		t.Errorf("Entry(placement) = %+v, %v", e, ok)
+	}
+}
+
+func TestCaptureSubtree(t *testing.T) {
+	tests := []struct {
+		path string
+		want map[string]bool // path to Directory
+	}{
+		{"meta-data/placement", map[string]bool{"meta-data/placement": true, "meta-data/placement/availability-zone": false, "meta-data/placement/region": false}},
+		{"meta-data/placement/", map[string]bool{"meta-data/placement": true, "meta-data/placement/availability-zone": false, "meta-data/placement/region": false}},
+		{"dynamic/instance-identity", map[string]bool{"dynamic/instance-identity": true, "dynamic/instance-identity/document": false}},
+		{"meta-data/instance-id", map[string]bool{"meta-data/instance-id": false}},
+		{"user-data", map[string]bool{"user-data": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			snap := capture(t, testTree, Options{Path: tt.path})
+			got := map[string]bool{}
+			for _, e := range snap.Entries {
+				if e.Status != http.StatusOK {
+					t.Errorf("Entry(%s) status = %d: %s", e.Path, e.Status, e.Error)
+				}
+				got[e.Path] = e.Directory
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("captured %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureErrorsAndRedaction(t *testing.T) {
+	snap := capture(t, `{"meta-data": {"instance-id": "i-1", "iam": {"security-credentials": {"my-role": {"Code": "Success"}}}}}`,
+		Options{Redact: DefaultRedact})
+
+	e, ok := snap.Entry("user-data")
+	if !ok || e.Status != http.StatusNotFound {
+		t.Errorf("Entry(user-data) = %+v, want status 404", e)
+	}
+	if _, err := snap.Get(context.Background(), "user-data"); err == nil {
+		t.Error("Get(user-data) error = nil, want captured 404")
+	}
+	if body, _ := snap.Get(context.Background(), "meta-data/iam/security-credentials/my-role"); string(body) != RedactedBody {
+		t.Errorf("credentials = %q, want redacted", body)
+	}
+	if len(snap.Redacted) != 1 || snap.Redacted[0] != "meta-data/iam/security-credentials/my-role" {
+		t.Errorf("Redacted = %v", snap.Redacted)
+	}
+}
+
+func TestEntryEncoding(t *testing.T) {
+	e := Entry{}
+	raw := []byte{0x1f, 0x8b, 0x08, 0x00, 0xff}
+	e.setBody(raw)
+	if e.Encoding != "base64" {
+		t.Errorf("Encoding = %q, want base64", e.Encoding)
+	}
+	if got, err := e.Bytes(); err != nil || !bytes.Equal(got, raw) {
+		t.Errorf("Bytes() = %v, %v, want %v", got, err, raw)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+)
+
+const (
+	// DeadlineFileEnv is the environment variable passed to the child that holds
+	// the path of the file the interruption deadline is written to.
+	DeadlineFileEnv = "IMDS_DEADLINE_FILE"
+
+	DefaultPollInterval = 5 * time.Second
+	DefaultKillBefore   = 10 * time.Second
+)
+
+// Notice kinds reported by the supervisor.
+const (
+	KindSpotInterruption = "spot-interruption"
+	KindRebalance        = "rebalance-recommendation"
+)
+
+// Notice describes an interruption notice observed in IMDS.
+type Notice struct {
+	Kind   string    `json:"kind"`
+	Action string    `json:"action,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Options configures how the child process is supervised.
+type Options struct {
+	// Signal is sent to the child's process group when a notice appears. Defaults to SIGTERM.
+	Signal syscall.Signal
+	// PollInterval is how often IMDS is checked for notices.
+	PollInterval time.Duration
+	// KillBefore is how long before the termination time the child is sent SIGKILL.
+	KillBefore time.Duration
+	// DeadlineFile is where the notice is written as JSON. A temporary file is used if empty.
+	DeadlineFile string
+	// IgnoreRebalance disables signaling on rebalance recommendations.
+	IgnoreRebalance bool
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Supervisor runs a child process and forwards interruption notices to it.
+type Supervisor struct {
+	client *imds.Client
+	opts   Options
+}
+
+// New creates a Supervisor, filling in defaults for unset options.
+func New(client *imds.Client, opts Options) *Supervisor {
+	if opts.Signal == 0 {
+		opts.Signal = syscall.SIGTERM
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.KillBefore < 0 {
+		opts.KillBefore = 0
+	}
+	if opts.Stdin == nil {
+		opts.Stdin = os.Stdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	return &Supervisor{client: client, opts: opts}
+}
+
+// Run starts the command and supervises it until it exits, returning its exit code.
+// If ctx is cancelled the configured signal is forwarded to the child and Run waits for it to exit.
+func (s *Supervisor) Run(ctx context.Context, name string, args ...string) (int, error) {
+	deadlineFile := s.opts.DeadlineFile
+	if deadlineFile == "" {
+		f, err := os.CreateTemp("", "imds-deadline-*.json")
+		if err != nil {
+			return -1, fmt.Errorf("creating deadline file: %w", err)
+		}
+		deadlineFile = f.Name()
+		f.Close()
+		defer os.Remove(deadlineFile)
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = s.opts.Stdin
+	cmd.Stdout = s.opts.Stdout
+	cmd.Stderr = s.opts.Stderr
+	cmd.Env = append(os.Environ(), DeadlineFileEnv+"="+deadlineFile)
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("starting %s: %w", name, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	var (
+		signaled bool
+		killC    <-chan time.Time
+		seen     = map[string]bool{}
+	)
+	forward := func(notices []Notice) {
+		for _, n := range notices {
+			if seen[n.Kind] {
+				continue
+			}
+			seen[n.Kind] = true
+			if err := writeNotice(deadlineFile, n); err != nil {
+				fmt.Fprintf(s.opts.Stderr, "imds: writing deadline file: %s\n", err)
+			}
+			if !signaled {
+				_ = signalGroup(cmd.Process, s.opts.Signal)
+				signaled = true
+			}
+			if n.Kind == KindSpotInterruption {
+				killC = time.After(time.Until(n.Time.Add(-s.opts.KillBefore)))
+			}
+		}
+	}
+
+	// A notice issued before the child started is forwarded right away
+	// rather than a poll interval into the two-minute warning.
+	forward(s.Poll(ctx))
+	ctxDone := ctx.Done()
+	for {
+		select {
+		case err := <-done:
+			var exitErr *exec.ExitError
+			if err != nil && !errors.As(err, &exitErr) {
+				return -1, err
+			}
+			return exitCode(cmd.ProcessState), nil
+		case <-ctxDone:
+			ctxDone = nil
+			if !signaled {
+				_ = signalGroup(cmd.Process, s.opts.Signal)
+				signaled = true
+			}
+		case <-killC:
+			killC = nil
+			_ = signalGroup(cmd.Process, syscall.SIGKILL)
+		case <-ticker.C:
+			forward(s.Poll(ctx))
+		}
+	}
+}
+
+// Poll checks IMDS for a spot interruption and, unless ignored, a rebalance recommendation.
+func (s *Supervisor) Poll(ctx context.Context) []Notice {
+	var notices []Notice
+	if action, err := s.client.SpotInstanceAction(ctx); err == nil {
+		notices = append(notices, Notice{Kind: KindSpotInterruption, Action: action.Action, Time: action.Time})
+	}
+	if !s.opts.IgnoreRebalance {
+		if rebalance, err := s.client.RebalanceRecommendation(ctx); err == nil {
+			notices = append(notices, Notice{Kind: KindRebalance, Time: rebalance.NoticeTime})
+		}
+	}
+	return notices
+}
+
+func writeNotice(path string, n Notice) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,138 @@
+//go:build !windows
+
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bwagner5/imds/pkg/imds"
+	"github.com/bwagner5/imds/pkg/mock"
+)
+
+func newTestSupervisor(t *testing.T, opts Options) (*Supervisor, *mock.Server) {
+	t.Helper()
+	fake := mock.New(nil, mock.Options{})
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := imds.NewClient(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	opts.PollInterval = 50 * time.Millisecond
+	opts.Stdout = io.Discard
+	opts.Stderr = io.Discard
+	return New(client, opts), fake
+}
+
+func TestRunPassesExitCode(t *testing.T) {
+	sup, _ := newTestSupervisor(t, Options{})
+	code, err := sup.Run(context.Background(), "sh", "-c", "exit 3")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if code != 3 {
+		t.Errorf("Run() = %d, want 3", code)
+	}
+}
+
+func TestRunForwardsSpotInterruption(t *testing.T) {
+	deadlineFile := filepath.Join(t.TempDir(), "deadline.json")
+	sup, fake := newTestSupervisor(t, Options{DeadlineFile: deadlineFile})
+	termination := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		fake.Set("meta-data/spot/instance-action",
+			fmt.Sprintf(`{"action":"terminate","time":%q}`, termination.Format(time.RFC3339)))
+	}()
+
+	code, err := sup.Run(context.Background(), "sh", "-c", `trap 'exit 42' TERM; while true; do sleep 0.05; done`)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if code != 42 {
+		t.Errorf("Run() = %d, want 42", code)
+	}
+
+	data, err := os.ReadFile(deadlineFile)
+	if err != nil {
+		t.Fatalf("reading deadline file: %v", err)
+	}
+	var notice Notice
+	if err := json.Unmarshal(data, &notice); err != nil {
+		t.Fatalf("decoding deadline file: %v", err)
+	}
+	if notice.Kind != KindSpotInterruption || !notice.Time.Equal(termination) {
+		t.Errorf("deadline file = %+v, want %s at %s", notice, KindSpotInterruption, termination)
+	}
+}
+
+func TestRunForwardsExistingNotice(t *testing.T) {
+	deadlineFile := filepath.Join(t.TempDir(), "deadline.json")
+	sup, fake := newTestSupervisor(t, Options{DeadlineFile: deadlineFile})
+	// Only the poll before the first tick can see the notice in time.
+	sup.opts.PollInterval = time.Hour
+	fake.Set("meta-data/spot/instance-action",
+		fmt.Sprintf(`{"action":"terminate","time":%q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	code, err := sup.Run(ctx, "sh", "-c", `trap 'exit 42' TERM; while true; do sleep 0.05; done`)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// The signal may arrive before the shell sets its trap.
+	if code != 42 && code != 143 {
+		t.Errorf("Run() = %d, want 42 or 143", code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("child signaled after %s, want before the first poll interval", elapsed)
+	}
+	if _, err := os.Stat(deadlineFile); err != nil {
+		t.Errorf("deadline file not written: %v", err)
+	}
+}
+
+func TestRunEscalatesToKill(t *testing.T) {
+	sup, fake := newTestSupervisor(t, Options{KillBefore: time.Hour})
+	fake.Set("meta-data/spot/instance-action",
+		fmt.Sprintf(`{"action":"terminate","time":%q}`, time.Now().Add(time.Minute).UTC().Format(time.RFC3339)))
+
+	code, err := sup.Run(context.Background(), "sh", "-c", `trap '' TERM; while true; do sleep 0.05; done`)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if code != 137 {
+		t.Errorf("Run() = %d, want 137", code)
+	}
+}
+
+func TestRunIgnoresRebalance(t *testing.T) {
+	sup, fake := newTestSupervisor(t, Options{IgnoreRebalance: true})
+	fake.Set("meta-data/events/recommendations/rebalance", `{"noticeTime":"2020-11-05T08:22:00Z"}`)
+	if notices := sup.Poll(context.Background()); len(notices) != 0 {
+		t.Errorf("Poll() = %v, want no notices", notices)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build windows
+
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// ParseSignal parses a signal name. Windows cannot deliver signals to other
+// processes, so every signal results in the child being killed.
+func ParseSignal(name string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "INT":
+		return syscall.SIGINT, nil
+	case "KILL":
+		return syscall.SIGKILL, nil
+	case "TERM":
+		return syscall.SIGTERM, nil
+	}
+	return 0, fmt.Errorf("unsupported signal %q", name)
+}
+
+func setProcessGroup(*exec.Cmd) {}
+
+func signalGroup(p *os.Process, _ syscall.Signal) error {
+	return p.Kill()
+}
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -115,7 +115,7 @@ func (i item) FilterValue() string {
 }
 
 type Model struct {
-	client       *imds.Client
+	client       imds.Backend
 	ctx          context.Context
 	data         map[string]any
 	list         list.Model
@@ -130,7 +130,7 @@ type Model struct {
 	allItems     []item // flattened list of all items for search
 }
 
-func New(ctx context.Context, client *imds.Client) *Model {
+func New(ctx context.Context, client imds.Backend) *Model {
 	m := &Model{
 		client: client,
 		ctx:    ctx,
@@ -388,7 +388,8 @@ func (m *Model) buildAllItems() {
 }
 
 func (m *Model) collectItems(data map[string]any, prefix string) {
-	for k, v := range data {
+	for _, k := range imds.SortedKeys(data) {
+		v := data[k]
 		fullPath := k
 		if prefix != "" {
 			fullPath = prefix + "/" + k
@@ -455,8 +456,9 @@ func (m *Model) filterSearch() {
 		}
 	}
 
-	// Sort by relevance: exact name match first, then by path length
-	sort.Slice(matches, func(i, j int) bool {
+	// Sort by relevance: exact name match first, then by path length, with
+	// ties kept in tree order
+	sort.SliceStable(matches, func(i, j int) bool {
 		iName := strings.ToLower(matches[i].name)
 		jName := strings.ToLower(matches[j].name)
 		iExact := iName == query
@@ -512,7 +514,7 @@ func (m *Model) updateList() {
 		if ii.isDir != jj.isDir {
 			return ii.isDir
 		}
-		return ii.name < jj.name
+		return imds.CompareKeys(ii.name, jj.name) < 0
 	})
 
 	m.list.SetItems(items)
@@ -535,7 +537,7 @@ func formatArray(arr []any) string {
 	return strings.Join(parts, "\n")
 }
 
-func Run(ctx context.Context, client *imds.Client) error {
+func Run(ctx context.Context, client imds.Backend) error {
 	p := tea.NewProgram(New(ctx, client), tea.WithAltScreen())
 	_, err := p.Run()
 	return err